@@ -3,10 +3,14 @@ module github.com/shihyuho/go-jenkins-trigger
 go 1.17
 
 require (
-	github.com/avast/retry-go v3.0.0+incompatible // indirect
-	github.com/bndr/gojenkins v1.1.0 // indirect
+	github.com/avast/retry-go v3.0.0+incompatible
+	github.com/bndr/gojenkins v1.1.0
+	github.com/spf13/cobra v1.2.1
+	github.com/spf13/pflag v1.0.5
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
-	github.com/spf13/cobra v1.2.1 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4 // indirect
 )
@@ -1,206 +1,2452 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/avast/retry-go"
 	"github.com/bndr/gojenkins"
+	"github.com/shihyuho/go-jenkins-trigger/pkg/trigger"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
 	"time"
 )
 
 const (
 	defaultJenkinsUrl      = "http://127.0.0.1:8080"
+	defaultRequestTimeout  = 30 * time.Second
+	defaultTriggerRetries  = 2
+	defaultConnectDelay    = 5 * time.Second
+	defaultFailLogLines    = 50
+	defaultFolderSeparator = "/"
+	defaultParamsDelimiter = "="
+	envPrefix              = "JT_"
+	paramsFormatJson       = "json"
+	paramsFormatYaml       = "yaml"
+	paramsFormatProperties = "properties"
 	defaultWait            = false
-	defaultWaitPollSecond  = 10
-	defaultWaitMaxAttempts = 60
+	defaultWaitMaxPollTime = 5 * time.Minute
+	minWaitPollTime        = time.Second
+	exitError              = 1
+	exitBuildFailed        = 2
+	exitTimeout            = 3
+	exitDisabled           = 4
+	notifyTimeout          = 10 * time.Second
+	outputText             = "text"
+	outputJson             = "json"
+	outputJsonl            = "jsonl"
+	outputUrl              = "url"
+	configFormatYaml       = "yaml"
+	configFormatJson       = "json"
+	redacted               = "REDACTED"
+	colorAuto              = "auto"
+	colorAlways            = "always"
+	colorNever             = "never"
 	desc                   = `This command triggers Jenkins job.
 
 You can specify the '--job'/'-j' flag to determine the name of the Jenkins job to run.
-To passing job parameters, use either the '--params'/'-p' flag in key=value format,
-can specify multiple or separate parameters with commas: foo=bar,baz=qux.
+To passing job parameters, use either the '--params'/'-p' flag in key=value format, which can be specified multiple times,
+the value is taken as it is, even if it contains commas or equal signs. Use '--params-csv' flag instead to separate parameters
+with commas: foo=bar,baz=qux, and quote the ones containing commas: '"msg=hello, world",foo=bar'.
 You can also use the '--params-json'/'-P' passing JSON format parameters from the command line.
 
   $ jenkins-trigger -j myjob
   $ jenkins-trigger -j myjob -p foo=bar -p baz=qux
-  $ jenkins-trigger -j myjob -p foo=bar,baz=qux
+  $ jenkins-trigger -j myjob -p 'message=hello, world'
+  $ jenkins-trigger -j myjob --params-csv foo=bar,baz=qux
   $ jenkins-trigger -j myjob -P '{"foo":"bar","baz":"qux"}'
 
-You can specify the '--jenkins-url' flag to set the url of the Jenkins server,
-and '--jenkins-user'/'--jenkins-pat' flag to set the user and personal access token (PAT)
+Use '--params-delimiter' flag to separate the keys and the values of '--params'/'-p' and '--params-csv' with another
+separator than '=', e.g., for the keys containing '='. The parameters of '--params-csv' are split by commas first,
+and then by the delimiter, so the delimiter can not be a comma along with '--params-csv'.
+
+  $ jenkins-trigger -j myjob --params-delimiter : -p foo:bar -p 'query:a=b'
+
+Pass '-' to the '--params-json'/'-P' flag to read the JSON from stdin, which keeps the secrets out of the command line.
+
+  $ echo '{"password":"secret"}' | jenkins-trigger -j myjob -P - -p foo=bar
+
+Use '--params-yaml' flag likewise to pass a YAML object, or - to read it from stdin, e.g., the parameters maintained in YAML.
+The values are taken as they are written, e.g., 1.10 stays 1.10, and must not be nested structures.
+
+  $ jenkins-trigger -j myjob --params-yaml - < params.yaml
+
+Use '--params-file' to read parameters from a file, which contains key=value pairs one per line
+('#' comments and empty lines are skipped), or a JSON object if the file has '.json' extension,
+or a YAML object if '.yaml' or '.yml'. Use '--params-file-format' flag (json, yaml or properties) to override
+the detection by the extension, e.g., for a generated file with an arbitrary name.
+Specify '--params-file' multiple times to layer the files, which are merged in order, the later files override the earlier ones,
+e.g., a base file followed by the environment-specific overrides.
+Use '--param-from-env' to read parameters from the environment variables in ENV=name format,
+or just ENV if the parameter has the same name, append ':-default' to fall back to a default value if ENV is unset.
+When a parameter is given in multiple ways, the precedence is: --params, --params-csv, --bool-param, --choice-param > --param-from-env > --params-yaml > --params-json > --params-file (the last one first) > '--config' file,
+use '--strict-params' flag to reject a parameter which is given in more than one way instead, the layered '--params-file' count as one way.
+
+  $ jenkins-trigger -j myjob --params-file params.properties
+  $ jenkins-trigger -j myjob --params-file params.json -p foo=bar
+  $ jenkins-trigger -j myjob --params-file params.txt --params-file-format json
+  $ jenkins-trigger -j myjob --params-file base.properties --params-file prod.properties -p foo=bar
+  $ jenkins-trigger -j myjob --param-from-env GIT_COMMIT=commit --param-from-env BRANCH:-main
+
+Use '--expand-params' flag to expand the environment variables in the values of the parameters from all the sources,
+in $VAR or ${VAR} format, and $$ for a literal $. An undefined variable is an error,
+unless '--expand-params-allow-empty' flag is set, which expands it to empty.
+
+  $ jenkins-trigger -j myjob --expand-params -p 'version=${GIT_TAG}-${BUILD_ID}'
+
+Use '--if-not-building' flag to skip triggering the job if it has a build in progress or in the queue,
+e.g., to prevent concurrent deploys, which exits 0 and prints a message. A skipped job is not waited for,
+and has field skipped in '--output json'.
+
+  $ jenkins-trigger -j deploy --wait --if-not-building
+
+The job is triggered at /buildWithParameters if it defines any parameter or any parameter is given,
+otherwise at /build. Use '--force-with-parameters' flag to always trigger it at /buildWithParameters,
+e.g., for a job whose parameters are added by a plugin and not listed in its definition.
+
+  $ jenkins-trigger -j myjob --force-with-parameters
+
+Triggering the job is retried when the connection is refused or Jenkins responds 502/503/504,
+use '--trigger-retries' flag to set how many times to retry, which defaults to 2.
+
+Use '--correlation-param' flag to tag the build with a unique parameter in KEY=VALUE format, or KEY to generate a random VALUE.
+When waiting, the build is located by scanning the recent builds for the parameter instead of trusting the queue item,
+which might be mapped to a wrong build on heavily loaded Jenkins servers. The job has to define the parameter KEY.
+
+  $ jenkins-trigger -j myjob --wait --correlation-param TRIGGER_ID=$(uuidgen)
+  $ jenkins-trigger -j myjob --wait --correlation-param TRIGGER_ID
+
+Use '--fingerprint' flag instead to tag the build the same way, but trust the build of the queue item once it's verified
+to carry the parameter, the recent builds are scanned for it only if it does not, e.g., another build started concurrently
+is mapped to the queue item. It costs fewer requests than '--correlation-param' in the usual case.
+
+  $ jenkins-trigger -j myjob --wait --fingerprint TRIGGER_ID
+
+Jenkins takes all the parameters as strings, use '--bool-param' flag for a boolean parameter, the value is one of:
+true, false, yes, no, on, off, 1, 0, and is sent as true or false, since Jenkins treats anything other than true
+(ignoring case) as false, e.g., yes or 1 would silently turn the parameter off.
+Use '--choice-param' flag for a choice parameter, the value is checked against the choices of the job before triggering,
+to fail early with the valid choices listed, instead of leaving an invalid choice to Jenkins or the plugins.
+
+  $ jenkins-trigger -j myjob --bool-param deploy=yes --choice-param env=staging
+
+Use '--params-from-build' flag to copy the parameters from a previous build of the job, which are overridden by
+the parameters given in the other ways, e.g., to rerun a failed build with a tweak. The masked passwords are not copied.
+
+  $ jenkins-trigger -j myjob --params-from-build 42 -p foo=baz
+
+Use '--file-param' flag in name=path format to upload a file as the file parameter of the job,
+the other parameters are submitted along with the files.
+
+  $ jenkins-trigger -j myjob -p foo=bar --file-param config.yaml=./config.yaml
+
+Use '--validate-params' flag to check the parameters against the ones defined by the job before triggering.
+
+  $ jenkins-trigger -j myjob -p foo=bar --validate-params
+
+You can specify the '--dry-run' flag to print the resolved job URL and parameters,
+without connecting to the Jenkins server or triggering the job.
+
+  $ jenkins-trigger -j myjob -p foo=bar --dry-run
+
+Use '--print-config' flag to print the effective configuration resolved from the '--config' file, the environment variables
+and the flags in YAML, or '--print-config=json' in JSON, and exit without triggering the job, e.g., to debug the precedence.
+The PAT, the build token, the values of the cookies and the headers, and the notify URL are redacted.
+
+  $ JT_WAIT=true jenkins-trigger --config jenkins.yaml -j myjob --print-config
+
+You can specify the '--output'/'-o' flag to 'json' to print the results as JSON objects to stdout,
+one object per job, with fields: job, queueId, queueUrl, buildNumber, url, result, duration, builtOn (the node the build runs on) and artifacts.
+The human-readable progress is printed to stderr in this format.
+
+  $ jenkins-trigger -j myjob --wait -o json
+
+Use '--output'/'-o' flag 'jsonl' to print the events as JSON lines to stdout while they happen, for the streaming consumers,
+with fields: status (triggered, queued, running or completed), timestamp, elapsed, why, error and the fields of the result above.
+The last event of each job is 'completed' if waiting, which carries the result, or the error if the waiting failed.
+
+  $ jenkins-trigger -j myjob --wait -o jsonl
+
+Use '--output-template' flag to print each result to stdout with a Go text/template instead, followed by a newline,
+e.g., for a consumer which wants another shape. The fields are: .Job, .QueueId, .QueueUrl, .BuildNumber, .Url, .Result,
+.Duration, .BuiltOn, .Artifacts, .Downstream (the results of the downstream builds), .Tests (with .Total, .Failed, .Skipped
+and .FailedTests, nil without '--test-report') and .Skipped. The progress is printed to stderr in this format.
+
+  $ jenkins-trigger -j myjob --wait --output-template '{{.BuildNumber}} {{.Result}}'
+  $ jenkins-trigger -j myjob --wait --output-template '{{.Job}}: {{range .Artifacts}}{{.}} {{end}}'
+
+Use '--output'/'-o' flag 'url' to print just the URL of each job to stdout, e.g., to post it to a chat channel,
+which is the URL of the queue item right after triggering, or the URL of the build if waiting.
+
+  $ echo "Deploying: $(jenkins-trigger -j myjob -o url)"
+  $ jenkins-trigger -j myjob --wait-for-start -o url
+
+Use '--result-file' flag to write the results to a file as a JSON document once the jobs are done, even if they failed,
+with field results, which are the objects of the results above, along with field error if the job failed,
+e.g., for an orchestrator which reads the results from a file instead of stdout.
+
+  $ jenkins-trigger -j myjob --wait --result-file result.json
+
+Use '--quiet'/'-q' flag to suppress the progress output, only errors are printed to stderr,
+and the results are still printed if '--output json' is given.
+
+  $ jenkins-trigger -j myjob --wait -q
+
+Use '--log-level' flag to set the level of the progress logs, one of: debug, info (default), warn, error,
+the metadata of the HTTP requests and responses to Jenkins are logged at debug level, with the credentials redacted.
+Use '--log-format json' flag to print each log record as a JSON object with time, level and msg fields, for the log pipelines.
+
+  $ jenkins-trigger -j myjob --wait --log-level debug --log-format json
+
+The statuses in the progress are colored if it's printed to a terminal, unless the NO_COLOR environment variable is set,
+use '--color always' or '--color never' flag to turn the colors on or off regardless.
+
+  $ jenkins-trigger -j myjob --wait --color never
+
+To run multiple jobs, specify the '--job'/'-j' flag multiple times or separate names with commas,
+the parameters are shared across all the jobs, and a summary table of the jobs is printed to stderr at the end.
+
+  $ jenkins-trigger -j jobA -j jobB -p foo=bar
+  $ jenkins-trigger -j jobA,jobB -p foo=bar
+
+By default, all the jobs are triggered first, and then waited for one by one.
+Use '--parallel' flag to trigger and wait for up to that many jobs concurrently instead, e.g., for a batch of smoke tests,
+the console output of each job is prefixed with its name when following the logs.
+Use '--fail-fast' flag to stop on the first job which fails, the rest of the jobs are not triggered,
+and the builds being waited for are aborted.
+
+  $ jenkins-trigger -j jobA,jobB,jobC,jobD --wait --parallel 2 --fail-fast
+
+Use '--job-path' flag to specify the job in folders by the slash-delimited path,
+the last segment is the job and the rest are folders.
+It can be given multiple times as well, and along with '--job'/'-j', all the given jobs are triggered,
+the ones of '--job'/'-j' first.
+
+  $ jenkins-trigger --job-path foo/bar/myjob
+  $ jenkins-trigger -j jobA --job-path foo/jobB
+
+Use '--folder-separator' flag to split '--job-path' by another separator than slash, e.g., the paths from Windows.
+
+  $ jenkins-trigger --job-path 'foo\bar\myjob' --folder-separator '\'
+
+Use '--job-folder'/'-f' flag to put the jobs of '--job'/'-j' in folders, outermost first, which can be given multiple times
+for the nested folders, and is not split by commas. Each one is split by the folder separator like '--job-path',
+unless '--literal-folders' flag is set, which takes each one verbatim as a single folder, e.g., a name containing a slash.
+
+  $ jenkins-trigger -f foo -f bar -j myjob
+  $ jenkins-trigger -f 'foo/bar' -j myjob
+  $ jenkins-trigger -f 'a/b' -j myjob --literal-folders
+
+Use '--branch' flag to run the branch of a multibranch pipeline job.
+Multibranch pipelines encode '/' in the branch names, which is taken care of,
+e.g., feature/foo of myproject is triggered at /job/myproject/job/feature%252Ffoo.
+
+  $ jenkins-trigger -j myproject --branch main
+  $ jenkins-trigger --job-path team/myproject --branch feature/foo
+
+You can specify the '--jenkins-url' flag to set the url of the Jenkins server, which must start with http:// or https://,
+the trailing slashes are stripped. And '--jenkins-user'/'--jenkins-pat' flag to set the user and personal access token (PAT)
 if the Jenkins server requires auth to access.
 
   $ jenkins-trigger -j myjob --jenkins-url http://myjenkins.com:8080 --jenkins-user me --jenkins-pat mytoken
 
+Use '--jenkins-pat-file' flag instead of '--jenkins-pat' to read the token from a file, e.g., a secret mounted by Kubernetes.
+
+  $ jenkins-trigger -j myjob --jenkins-url http://myjenkins.com:8080 --jenkins-user me --jenkins-pat-file /var/run/secrets/jenkins/pat
+
+Use '--build-token' flag to trigger the job with the token of its "Trigger builds remotely" option, which is sent as the
+token query parameter. The token only authorizes triggering the job, the other requests, e.g., verifying the connection
+and waiting for the build, are still sent with '--jenkins-user'/'--jenkins-pat' if given, or anonymously otherwise,
+so without a user, use '--no-init' flag and no '--wait' if the anonymous user can not read Jenkins,
+and '--force-with-parameters' flag for a parameterized job if none is given, since its definition can not be read.
+
+  $ jenkins-trigger -j myjob --jenkins-url http://myjenkins.com:8080 --build-token mytoken --no-init
+
+Use '--cookie' flag to send cookies along with the requests, e.g., the session cookie issued by an SSO proxy in front of Jenkins,
+or '--cookie-file' flag to read them from a file, name=value pairs one per line, or in Netscape cookies.txt format.
+
+  $ jenkins-trigger -j myjob --jenkins-url https://myjenkins.com --cookie SESSION=abc123
+
+Use '--header' flag to send extra headers in "Name: value" format along with all the requests, e.g., the API key required
+by an API gateway in front of Jenkins, or '--header-from-env' flag in ENV=Name format to read the value from an environment
+variable instead, which keeps the secret off the command line.
+
+  $ jenkins-trigger -j myjob --jenkins-url https://gateway.mycompany.com/jenkins --header "X-Api-Key: secret"
+  $ jenkins-trigger -j myjob --jenkins-url https://gateway.mycompany.com/jenkins --header-from-env API_KEY=X-Api-Key
+
+Use '--ca-cert' flag to verify the Jenkins server with the CA certificates in a PEM file,
+instead of turning off the verification by '--insecure'.
+
+  $ jenkins-trigger -j myjob --jenkins-url https://myjenkins.com --ca-cert internal-ca.pem
+
+Use '--tls-server-name' flag to verify the certificate against another hostname than the one in '--jenkins-url',
+e.g., the Jenkins server is reached through a load balancer, the certificate chain is still verified unlike '--insecure'.
+
+  $ jenkins-trigger -j myjob --jenkins-url https://10.0.0.8 --tls-server-name myjenkins.com
+
+Use '--jenkins-host' flag to send another Host header than the host in '--jenkins-url', e.g., the Jenkins server is only
+reachable through a port forwarded by 'kubectl port-forward' or an SSH tunnel, whose local port may change per session,
+while Jenkins or the reverse proxy in front of it routes the requests by the Host header.
+The certificate of the server is verified against the hostname of '--jenkins-host' too, unless '--tls-server-name' is set.
+
+  $ ssh -L 8443:myjenkins.com:443 bastion
+  $ jenkins-trigger -j myjob --jenkins-url https://localhost:8443 --jenkins-host myjenkins.com
+
+Use '--client-cert' and '--client-key' flags to authenticate with a client certificate if the Jenkins server requires mutual TLS.
+
+  $ jenkins-trigger -j myjob --jenkins-url https://myjenkins.com --client-cert me.crt --client-key me.key
+
+The HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are honored,
+use '--proxy' flag to access the Jenkins server through a specific proxy server instead.
+
+  $ jenkins-trigger -j myjob --jenkins-url https://myjenkins.com --proxy http://proxy.mycorp.com:3128
+
+A CSRF crumb is fetched from the crumb issuer of the Jenkins server and attached to the trigger requests,
+use '--no-crumb' flag to skip it.
+
+The connection and credentials are verified by a request to the Jenkins server before anything else,
+use '--no-init' flag to skip it and save a round-trip, e.g., to trigger many jobs in a loop. The trade-off is that
+an unreachable server or invalid credentials are then reported by the first real request, e.g., triggering the job.
+Along with '--no-crumb', no request is made before triggering the job.
+
+  $ jenkins-trigger -j myjob --no-init --no-crumb
+
+Use '--connect-retries' flag to retry verifying the connection when it's refused or Jenkins responds 502/503/504,
+e.g., Jenkins is restarting in a rolling update right when the job is triggered, every '--connect-retry-delay' apart,
+or longer if Jenkins asks so by Retry-After. It's not retried by default.
+
+  $ jenkins-trigger -j myjob --connect-retries 12 --connect-retry-delay 10s
+
 You can specify the '--wait' flag to waiting for the job complete, and return the results.
-Use '--poll-time' flag (in duration format) to set how often to poll the jenkins server for results.
-Use '--max-attempts' flag to set the max count of polling for results.
+When multiple jobs are given, it waits for all of them and fails if any one of them fails.
+Use '--poll-time' flag (in duration format) to set how often to poll the jenkins server for results, which must be at least 1s.
+Use '--max-attempts' flag to set the max count of polling for results, which must be greater than 0.
+Use '--timeout' flag (in duration format) to set an overall deadline, whichever of '--max-attempts' and '--timeout' is hit first wins.
+While the build is waiting in the queue, the reason (e.g., waiting for next available executor) is printed on each poll,
+use '--queue-timeout' flag (in duration format) to cancel the queue item if the build does not start in time since it's triggered.
+Use '--abort-after' flag (in duration format) to abort the build once it has been running longer than that, e.g., a stuck one,
+which is then reported as ABORTED, unlike '--timeout' which only gives up waiting.
+Each HTTP request to Jenkins is limited by '--request-timeout' flag (in duration format) separately, which defaults to 30s, except downloading the artifacts.
 
   $ jenkins-trigger -j myjob --wait
   $ jenkins-trigger -j myjob --wait --poll-time 10s --max-attempts 60
+  $ jenkins-trigger -j myjob --wait --timeout 30m
+  $ jenkins-trigger -j myjob --wait --queue-timeout 10m
+  $ jenkins-trigger -j myjob --wait --abort-after 20m
+
+The result of the build (SUCCESS, UNSTABLE, FAILURE, ABORTED, etc.) is printed once it's completed.
+SUCCESS and UNSTABLE builds are treated as passed, use '--fail-on-unstable' flag to treat UNSTABLE as failed.
+
+  $ jenkins-trigger -j myjob --wait --fail-on-unstable
+
+Use '--accept-results' flag to set exactly which results count as passed instead, e.g., SUCCESS and ABORTED,
+the builds of the other results fail with exit code 2.
+
+  $ jenkins-trigger -j myjob --wait --accept-results SUCCESS,ABORTED
+
+Use '--wait-for-start' flag instead of '--wait' to stop waiting once the build has left the queue and started,
+which prints the build URL without waiting for the build to complete.
+
+  $ jenkins-trigger -j myjob --wait-for-start
+
+Use '--wait-downstream' flag to wait for the downstream builds as well once the build is completed, recursively,
+i.e., the builds of the downstream projects of the job (e.g., by the 'Build other projects' post-build action)
+which are caused by the build, and fail if any one of them fails. It implies '--wait'.
+
+  $ jenkins-trigger -j myjob --wait-downstream
+
+Use '--backoff exponential' flag to double the polling interval after each poll, starting from '--poll-time',
+up to '--max-poll-time'.
+
+  $ jenkins-trigger -j myjob --wait --backoff exponential --poll-time 5s --max-poll-time 2m
+
+Use '--jitter' flag to randomize each polling interval by up to that fraction of it, e.g., 0.2 is ±20%,
+so that dozens of jobs waited with the same '--poll-time' at once do not poll a shared Jenkins in lockstep.
+
+  $ jenkins-trigger -j myjob --wait --poll-time 10s --jitter 0.2
+
+While waiting, the first SIGINT/SIGTERM (e.g., Ctrl+C) aborts the builds before exiting, and a second one exits immediately.
+Use '--no-abort-on-signal' flag to leave the builds running.
+
+Use '--cause' flag along with '--wait' to set the description of the build once it's started,
+which shows who or what triggered the build in the Jenkins UI.
+
+  $ jenkins-trigger -j myjob --wait --cause "triggered by deploy bot"
+
+Use '--download-artifact' flag along with '--wait' to download the artifacts matching the glob once the build is completed successfully,
+the glob is matched against the relative path or the file name of the artifacts.
+Use '--output-dir' flag to set the directory to save the artifacts to, which defaults to the current directory.
+
+  $ jenkins-trigger -j myjob --wait --download-artifact '*.jar' --output-dir dist
+
+Use '--test-report' flag along with '--wait' to print the total, failed and skipped counts of the test results once
+the build is completed, whether it succeeded or not, which are in field tests of '--output json' as well.
+Use '--list-failed-tests' flag to print the names of the failed tests, and '--fail-on-test-failures' flag to exit 2
+if any test failed even if the result of the build is SUCCESS, both of them imply '--test-report'.
+
+  $ jenkins-trigger -j myjob --wait --test-report --list-failed-tests --fail-on-test-failures
+
+If the build did not succeed, the last 50 lines of the console output are printed to stderr,
+use '--fail-log-lines' flag to change how many lines, or 0 to turn it off.
+
+Use '--follow-logs' flag along with '--wait' to print the console output of the build while waiting.
+Use '--log-file' flag along with '--wait' to write the full console output of the build to a file as it streams,
+with or without '--follow-logs', the file contains the complete console output once the build is completed.
+
+  $ jenkins-trigger -j myjob --wait --follow-logs
+  $ jenkins-trigger -j myjob --wait --log-file build.log
+
+Use '--max-log-bytes' flag to stop streaming the console output to the terminal and the '--log-file' once it exceeds
+that many bytes, e.g., to guard against a runaway build filling the disk, the waiting goes on for the result regardless.
+
+  $ jenkins-trigger -j myjob --wait --follow-logs --log-file build.log --max-log-bytes 104857600
+
+Use '--tail' flag along with '--follow-logs' to skip the console output so far and follow it from the end,
+or '--from-byte' flag to follow it from a byte offset, e.g., to re-attach to a long-running build with 'wait' command
+without replaying its large console output. Note that the console output so far is still downloaded once with '--tail',
+to find where it ends, and neither can be used along with '--log-file', which contains the complete console output.
+
+  $ jenkins-trigger wait --queue-id 12345 --follow-logs --tail
+
+Use '--notify-url' flag along with '--wait' to POST a JSON object to a webhook when the build starts and when it finishes,
+with fields job, buildNumber, status (started or finished), url, result and error, and field text which describes it
+in a sentence, e.g., for Slack or Teams incoming webhooks. A failure of notifying is logged and does not fail the run.
+The webhook is requested through '--proxy', with '--ca-cert', '--insecure' and the client certificate as Jenkins is.
+
+  $ jenkins-trigger -j myjob --wait --notify-url https://hooks.slack.com/services/T000/B000/XXXX
+
+Use 'wait' command to wait for the build of a queue item which is already created, without triggering any job.
+
+  $ jenkins-trigger wait --queue-id 12345
+
+Use 'params' command to list the parameters of the job, including the name, type, default value and choices.
+
+  $ jenkins-trigger params -j myjob
+
+Use 'rebuild' command to trigger the job with the parameters of its last build, which are overridden by '--params'.
+
+  $ jenkins-trigger rebuild -j myjob -p foo=baz
+
+Use 'ping' command to verify the connection and credentials of the Jenkins server without triggering any job.
+
+  $ jenkins-trigger ping --jenkins-url http://myjenkins.com:8080 --jenkins-user me --jenkins-pat mytoken
+
+You can specify the '--config' flag to load settings from a YAML file,
+flags given on the command line override values from the file.
+
+  $ cat ~/.jenkins-trigger.yaml
+  jenkins:
+    url: http://myjenkins.com:8080
+    user: me
+    pat: mytoken
+  wait:
+    enabled: true
+    poll-time: 10s
+    max-attempts: 60
+  $ jenkins-trigger -j myjob --config ~/.jenkins-trigger.yaml
+
+Every flag can also be set by the environment variable named after it with prefix 'JT_', in upper case with
+the dashes replaced by underscores, e.g., JT_JENKINS_URL for '--jenkins-url' and JT_WAIT for '--wait'.
+The flags given on the command line override the environment variables, which override the values from the '--config' file.
+The flags which can be specified multiple times are split by commas, except the ones whose values may contain commas,
+which take the environment variable as a single value: '--params'/'-p', '--bool-param', '--choice-param', '--file-param',
+'--params-file', '--param-from-env', '--job-folder'/'-f', '--cookie' and '--header'.
+
+  $ JT_JENKINS_URL=http://myjenkins.com:8080 JT_JOB=myjob JT_WAIT=true jenkins-trigger
+
+Use 'completion' command to generate the autocompletion script for bash, zsh, fish or powershell.
+The names of '--job', '--job-path' and '--job-folder' are completed by querying Jenkins for the jobs and the folders,
+if it can be reached with the Jenkins flags, environment variables or '--config' file given so far.
+
+  $ source <(jenkins-trigger completion bash)
+  $ jenkins-trigger completion zsh > "${fpath[1]}/_jenkins-trigger"
+
+Exit codes:
+
+  0  the job was triggered, or the build completed successfully when waiting
+  1  usage error, or failed to communicate with the Jenkins server
+  2  the build completed but did not succeed, or was UNSTABLE with '--fail-on-unstable', or not in '--accept-results'
+  3  gave up waiting before the build completed, e.g., max attempts exhausted, or the --timeout deadline passed at any step
+  4  the job is disabled, use '--enable-if-disabled' flag to enable it before triggering
+
+When multiple jobs are given, the exit code is decided by the first job which did not succeed.
+Use '--ignore-result' flag to exit 0 even if the builds did not succeed or the waiting gave up (exit codes 2 and 3),
+the result is still printed.
+`
+	waitDesc = `This command waits for the build of a queue item which is already created, e.g., triggered by another system,
+and returns the result without triggering any job. The job is resolved from the queue item.
+The flags of waiting, such as '--poll-time', '--max-attempts' and '--follow-logs', are the same as the ones along with '--wait'.
+
+  $ jenkins-trigger wait --queue-id 12345
+  $ jenkins-trigger wait --queue-id 12345 --poll-time 5s --follow-logs
+
+Repeat '--queue-id' flag, or separate the IDs by comma, to wait for multiple queue items concurrently,
+e.g., the ones collected from the jobs triggered by different means. The console output of each job is prefixed with its name,
+and the command exits non-zero if any of the builds did not succeed.
+
+  $ jenkins-trigger wait --queue-id 12345 --queue-id 12346 --queue-id 12347
+  $ jenkins-trigger wait --queue-id 12345,12346,12347 --result-file results.json
+`
+	paramsDesc = `This command lists the parameter definitions of the job, including the name, type, default value, choices and description,
+without triggering the job.
+
+  $ jenkins-trigger params -j myjob
+  $ jenkins-trigger params --job-path foo/bar/myjob -o json
+`
+	rebuildDesc = `This command triggers the job with the parameters copied from its last build, the same as
+'--params-from-build' with the number of the last build, e.g., to rerun a flaky build. The parameters given by
+'--params' override the copied ones, and the masked passwords are not copied.
+The flags of waiting, such as '--wait', '--poll-time' and '--follow-logs', are the same as the ones of triggering.
+
+  $ jenkins-trigger rebuild -j myjob
+  $ jenkins-trigger rebuild -j myjob -p foo=baz --wait
+`
+	historyDesc = `This command lists the last builds of the job, including the number, result, start time and duration,
+without triggering the job, e.g., to check whether the job is flaky before triggering another run.
+
+  $ jenkins-trigger history -j myjob -n 10
+  $ jenkins-trigger history --job-path foo/bar/myjob -o json
+`
+	pingDesc = `This command verifies the connection and credentials of the Jenkins server,
+and prints the version of Jenkins and the authenticated user without triggering any job.
+
+  $ jenkins-trigger ping --jenkins-url http://myjenkins.com:8080 --jenkins-user me --jenkins-pat mytoken
 `
 )
 
+// progress is where the human-readable progress and the console output of the builds are written to
+var progress io.Writer = os.Stdout
+
+// logger logs the progress to progress, which is set up by the flags of logging
+var logger *trigger.Logger
+
+// version, commit and date are set at build time, e.g., -ldflags "-X main.version=1.0.0"
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
 func main() {
 	c := config{
-		Jenkins: jenkins{
-			Url: defaultJenkinsUrl,
+		Jenkins: trigger.Jenkins{
+			Url:               defaultJenkinsUrl,
+			RequestTimeout:    defaultRequestTimeout,
+			UserAgent:         "go-jenkins-trigger/" + version,
+			ConnectRetryDelay: defaultConnectDelay,
+		},
+		Job: job{
+			FolderSeparator: defaultFolderSeparator,
 		},
-		Job: job{},
 		Wait: wait{
-			Enabled:     defaultWait,
-			PollTime:    defaultWaitPollSecond * time.Second,
-			MaxAttempts: defaultWaitMaxAttempts,
+			Wait: trigger.Wait{
+				Enabled:      defaultWait,
+				PollTime:     trigger.DefaultPollTime,
+				MaxAttempts:  trigger.DefaultMaxAttempts,
+				Backoff:      trigger.BackoffFixed,
+				MaxPollTime:  defaultWaitMaxPollTime,
+				FailLogLines: defaultFailLogLines,
+			},
 		},
+		Artifacts: trigger.Artifacts{
+			Dir: ".",
+		},
+		TriggerRetries: defaultTriggerRetries,
+		Output:         outputText,
+		Parallel:       1,
+		LogLevel:       trigger.LevelInfo.String(),
+		LogFormat:      trigger.LogFormatText,
+		Color:          colorAuto,
 	}
 
-	params := params{}
+	params := params{delimiter: defaultParamsDelimiter}
+	configFile := ""
+	printConfig := ""
+	// run triggers the jobs, copying the parameters from the last builds of them if rebuild is set
+	run := func(cmd *cobra.Command, rebuild bool) (err error) {
+		if configFile != "" {
+			if err = c.load(configFile, cmd.Flags()); err != nil {
+				return
+			}
+		}
+		if rebuild {
+			c.Job.ParamsFromBuild = trigger.LastBuild
+		}
+		if c.Wait.ForStart && c.Wait.Downstream {
+			return fmt.Errorf("--wait-for-start and --wait-downstream can not be used together")
+		}
+		if c.Wait.ForStart || c.Wait.Downstream {
+			c.Wait.Enabled = true
+		}
+		if len(c.Job.Names) == 0 && len(c.Job.Paths) == 0 {
+			return fmt.Errorf("required flag \"job\" or \"job-path\" not set")
+		}
+		if c.Parallel == 0 {
+			return fmt.Errorf("invalid parallel 0, must be greater than 0")
+		}
+		if c.Job.Cause != "" && !c.Wait.Enabled {
+			return fmt.Errorf("--cause requires --wait, the description can only be set once the build is started")
+		}
+		if c.Artifacts.Pattern != "" && (!c.Wait.Enabled || c.Wait.ForStart) {
+			return fmt.Errorf("--download-artifact requires --wait, the artifacts can only be downloaded once the build is completed")
+		}
+		if (c.TestReport.Enabled || c.TestReport.ListFailed || c.TestReport.FailOnFailures) && (!c.Wait.Enabled || c.Wait.ForStart) {
+			return fmt.Errorf("--test-report requires --wait, the test results can only be fetched once the build is completed")
+		}
+		if c.Wait.LogFile != "" && (!c.Wait.Enabled || c.Wait.ForStart) {
+			return fmt.Errorf("--log-file requires --wait, the console output can only be written while waiting for the build to complete")
+		}
+		if c.NotifyUrl != "" && !c.Wait.Enabled {
+			return fmt.Errorf("--notify-url requires --wait, the build can only be tracked while waiting for it")
+		}
+		if err = c.setup(); err != nil {
+			return
+		}
+		if c.Job.Params, err = params.init(c.Job.Params); err != nil {
+			return
+		}
+		if c.Job.Files, err = params.initFiles(c.Job.Files); err != nil {
+			return
+		}
+		c.Job.Choices = params.choiceNames()
+		if err = c.Job.correlate(); err != nil {
+			return
+		}
+		if printConfig != "" {
+			return c.redacted().dump(printConfig)
+		}
+		ctx, cancel := c.context()
+		defer cancel()
+		return c.result(triggerBuild(ctx, c))
+	}
 	cmd := &cobra.Command{
 		Use:          "jenkins-trigger",
 		Short:        "Trigger Jenkins job in Go",
 		Long:         desc,
+		Version:      fmt.Sprintf("%s, commit %s, built at %s", version, commit, date),
 		SilenceUsage: true,
-		RunE: func(cmd *cobra.Command, args []string) (err error) {
-			c.Job.Params, err = params.init()
-			if err != nil {
-				return
-			}
-			return triggerBuild(c)
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return bindEnv(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(cmd, false)
 		},
 	}
 
+	persistentFlags := cmd.PersistentFlags()
+	persistentFlags.StringVar(&c.Jenkins.Url, "jenkins-url", c.Jenkins.Url, "URL of the Jenkins server, including the subpath if it's served under one, e.g., https://ci.example.com/jenkins/")
+	persistentFlags.StringVar(&c.Jenkins.User, "jenkins-user", c.Jenkins.User, "User for accessing Jenkins")
+	persistentFlags.StringVar(&c.Jenkins.Pat, "jenkins-pat", c.Jenkins.Pat, "Personal access token (PAT) for accessing Jenkins")
+	persistentFlags.StringVar(&c.Jenkins.PatFile, "jenkins-pat-file", c.Jenkins.PatFile, "Path of the file to read the personal access token (PAT) from, e.g., a mounted secret, can not be used with --jenkins-pat")
+	persistentFlags.BoolVarP(&c.Jenkins.Insecure, "insecure", "k", c.Jenkins.Insecure, "Allow insecure Jenkins server connections when using SSL")
+	persistentFlags.StringVar(&c.Jenkins.CaCert, "ca-cert", c.Jenkins.CaCert, "Path of the PEM bundle of CA certificates to verify the Jenkins server with")
+	persistentFlags.StringVar(&c.Jenkins.ClientCert, "client-cert", c.Jenkins.ClientCert, "Path of the PEM client certificate for mutual TLS authentication, requires --client-key")
+	persistentFlags.StringVar(&c.Jenkins.ClientKey, "client-key", c.Jenkins.ClientKey, "Path of the PEM private key of the client certificate, requires --client-cert")
+	persistentFlags.StringVar(&c.Jenkins.TlsServerName, "tls-server-name", c.Jenkins.TlsServerName, "The hostname to verify the certificate of the Jenkins server against instead of the one in --jenkins-url, e.g., behind a load balancer, the certificate chain is still verified")
+	persistentFlags.StringVar(&c.Jenkins.Proxy, "proxy", c.Jenkins.Proxy, "URL of the proxy server to access Jenkins through, overrides the HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables")
+	persistentFlags.DurationVar(&c.Jenkins.RequestTimeout, "request-timeout", c.Jenkins.RequestTimeout, "Time limit (duration) of each HTTP request to Jenkins, 0 means no limit")
+	persistentFlags.StringVar(&c.Jenkins.Host, "jenkins-host", c.Jenkins.Host, "The Host header of the requests to Jenkins instead of the host in --jenkins-url, e.g., connecting through a forwarded port or a tunnel, the certificate is verified against it too unless --tls-server-name is set")
+	persistentFlags.StringVar(&c.Jenkins.UserAgent, "user-agent", c.Jenkins.UserAgent, "User-Agent header of the requests to Jenkins")
+	persistentFlags.StringArrayVar(&c.Jenkins.Cookies, "cookie", c.Jenkins.Cookies, "Cookie in name=value format to send along with the requests, e.g., the session cookie of an SSO proxy, can specify multiple times")
+	persistentFlags.StringArrayVar(&c.Jenkins.Headers, "header", c.Jenkins.Headers, "Header in \"Name: value\" format to send along with all the requests, e.g., the API key of an API gateway, can specify multiple times")
+	persistentFlags.StringSliceVar(&c.Jenkins.HeadersFromEnv, "header-from-env", c.Jenkins.HeadersFromEnv, "The headers to send along with all the requests read from the environment variables in ENV=Name format, e.g., API_KEY=X-Api-Key")
+	persistentFlags.StringVar(&c.Jenkins.CookieFile, "cookie-file", c.Jenkins.CookieFile, "Path of the file to read the cookies from, name=value pairs one per line, or in Netscape cookies.txt format")
+	persistentFlags.BoolVar(&c.Jenkins.NoCrumb, "no-crumb", c.Jenkins.NoCrumb, "Do not attach a CSRF crumb to the requests, for Jenkins servers without CSRF protection")
+	persistentFlags.UintVar(&c.Jenkins.ConnectRetries, "connect-retries", c.Jenkins.ConnectRetries, "How many times to retry verifying the connection when it's refused or Jenkins responds 502/503/504, e.g., while Jenkins is restarting")
+	persistentFlags.DurationVar(&c.Jenkins.ConnectRetryDelay, "connect-retry-delay", c.Jenkins.ConnectRetryDelay, "How long to wait between the retries of verifying the connection, unless Jenkins asks for longer by Retry-After")
+	persistentFlags.BoolVar(&c.Jenkins.NoInit, "no-init", c.Jenkins.NoInit, "Do not verify the connection and credentials before the first request to save a round-trip, the errors surface on the first request instead, the 'ping' command always verifies")
+	persistentFlags.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level, one of: debug, info, warn, error. The metadata of the HTTP requests and responses are logged at debug level")
+	persistentFlags.StringVar(&c.LogFormat, "log-format", c.LogFormat, "Log format, one of: text, json. In json format, each log record is printed as a JSON object per line")
+	persistentFlags.StringVar(&c.Color, "color", c.Color, "When to color the statuses in the progress, one of: auto, always, never. In auto, the progress is colored if it's printed to a terminal and NO_COLOR is not set")
+	persistentFlags.StringVar(&configFile, "config", configFile, "Path of the YAML file to load settings from, flags override values in the file")
+
 	flags := cmd.Flags()
-	flags.StringVar(&c.Jenkins.Url, "jenkins-url", c.Jenkins.Url, "URL of the Jenkins server")
-	flags.StringVar(&c.Jenkins.User, "jenkins-user", c.Jenkins.User, "User for accessing Jenkins")
-	flags.StringVar(&c.Jenkins.Pat, "jenkins-pat", c.Jenkins.Pat, "Personal access token (PAT) for accessing Jenkins")
-	flags.BoolVarP(&c.Jenkins.Insecure, "insecure", "k", c.Jenkins.Insecure, "Allow insecure Jenkins server connections when using SSL")
-	flags.StringVarP(&c.Job.Name, "job", "j", c.Job.Name, "The name of the Jenkins job to run")
-	flags.StringSliceVarP(&params.slice, "params", "p", params.slice, "The parameters of the job in key=value format, can specify multiple or separate parameters with commas, e.g., foo=bar,baz=qux")
-	flags.StringVarP(&params.json, "params-json", "P", params.json, "The parameters of the job in JSON format, e.g., {\"foo\":\"bar\",\"baz\":\"qux\"}")
+	jobFlags(flags, &c)
+	completeJobFlags(cmd, &c, &configFile)
+	paramsFlags(flags, &params)
+	flags.Int64Var(&c.Job.ParamsFromBuild, "params-from-build", c.Job.ParamsFromBuild, "The number of a previous build of the job to copy the parameters from, which are overridden by the other parameters, e.g., to rerun a failed build with a tweak")
+	flags.StringVar(&c.Job.Fingerprint, "fingerprint", c.Job.Fingerprint, "The parameter in KEY=VALUE format to tag the build with, or KEY to generate a random VALUE, the build of the queue item is verified to carry it when waiting, the recent builds are scanned for it if not")
+	flags.StringVar(&c.Job.Correlation, "correlation-param", c.Job.Correlation, "The parameter in KEY=VALUE format to tag the build with, or KEY to generate a random VALUE, the build is located by scanning the recent builds for it instead of trusting the queue item when waiting")
+	flags.BoolVar(&c.Job.ValidateParams, "validate-params", c.Job.ValidateParams, "Reject the parameters which are not defined by the job before triggering, and warn about the defined ones which are not supplied")
+	flags.StringVar(&c.Job.Cause, "cause", c.Job.Cause, "Set the description of the build to annotate who or what triggered it, e.g., \"triggered by deploy bot\", requires --wait")
 	flags.BoolVar(&c.Wait.Enabled, "wait", c.Wait.Enabled, "Wait for the job to complete, and return the results")
-	flags.DurationVar(&c.Wait.PollTime, "poll-time", c.Wait.PollTime, "How often (duration) to poll the Jenkins server for results")
-	flags.UintVar(&c.Wait.MaxAttempts, "max-attempts", c.Wait.MaxAttempts, "Max count of polling for results")
+	flags.BoolVar(&c.Wait.ForStart, "wait-for-start", c.Wait.ForStart, "Wait for the build to leave the queue and start, and print the build URL without waiting for it to complete")
+	waitFlags(flags, &c)
+	flags.UintVar(&c.TriggerRetries, "trigger-retries", c.TriggerRetries, "How many times to retry triggering the job when the connection is refused or Jenkins responds 502/503/504")
+	flags.UintVar(&c.Parallel, "parallel", c.Parallel, "How many jobs to trigger and wait for concurrently, the console output of each job is prefixed with its name. 1 triggers all the jobs first and then waits for them one by one")
+	flags.BoolVar(&c.FailFast, "fail-fast", c.FailFast, "Stop on the first job which fails, the rest of the jobs are not triggered and the builds being waited for are aborted")
+	flags.BoolVar(&c.Job.IfNotBuilding, "if-not-building", c.Job.IfNotBuilding, "Skip triggering the job and exit 0 if it has a build in progress or in the queue, e.g., to prevent concurrent deploys")
+	flags.BoolVar(&c.Job.EnableIfDisabled, "enable-if-disabled", c.Job.EnableIfDisabled, "Enable the job before triggering it if it's disabled, instead of exiting with code 4")
+	flags.StringVar(&c.Job.BuildToken, "build-token", c.Job.BuildToken, "The token of the \"Trigger builds remotely\" option of the job, which authorizes triggering the job only, not the other requests")
+	flags.BoolVar(&c.Job.ForceWithParameters, "force-with-parameters", c.Job.ForceWithParameters, "Always trigger the job at /buildWithParameters, instead of at /build if the job has no parameters and none is given")
+	flags.BoolVar(&c.DryRun, "dry-run", c.DryRun, "Print the resolved request without connecting to Jenkins or triggering the job")
+	flags.StringVar(&printConfig, "print-config", printConfig, "Print the effective configuration in the format, one of: yaml, json, with the secrets redacted, and exit without triggering the job")
+	flags.Lookup("print-config").NoOptDefVal = configFormatYaml
 
-	cmd.MarkFlagRequired("job")
+	cmd.AddCommand(&cobra.Command{
+		Use:          "ping",
+		Short:        "Check the connection and credentials of the Jenkins server",
+		Long:         pingDesc,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configFile != "" {
+				if err := c.load(configFile, cmd.Flags()); err != nil {
+					return err
+				}
+			}
+			if err := c.setup(); err != nil {
+				return err
+			}
+			ctx, cancel := c.context()
+			defer cancel()
+			return ping(ctx, c)
+		},
+	})
 
-	if err := cmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	var queueIds []int64
+	waitCmd := &cobra.Command{
+		Use:          "wait",
+		Short:        "Wait for the build of a queue item which is already created",
+		Long:         waitDesc,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if configFile != "" {
+				if err = c.load(configFile, cmd.Flags()); err != nil {
+					return
+				}
+			}
+			c.Wait.Enabled = true
+			if err = c.setup(); err != nil {
+				return
+			}
+			ctx, cancel := c.context()
+			defer cancel()
+			return c.result(waitBuilds(ctx, c, queueIds))
+		},
 	}
-}
-
-func triggerBuild(c config) error {
-	fmt.Printf("Triggering Jenkins build for job: %+v, wait: %+v\n", c.Job, c.Wait)
+	waitCmd.Flags().Int64SliceVar(&queueIds, "queue-id", queueIds, "The IDs of the queue items to wait for, can be repeated or comma-separated to wait for all of them concurrently")
+	_ = waitCmd.MarkFlagRequired("queue-id")
+	waitFlags(waitCmd.Flags(), &c)
+	cmd.AddCommand(waitCmd)
 
-	jenkins, err := c.Jenkins.createClient()
-	if err != nil {
-		return err
+	paramsCmd := &cobra.Command{
+		Use:          "params",
+		Short:        "List the parameters of the job",
+		Long:         paramsDesc,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if configFile != "" {
+				if err = c.load(configFile, cmd.Flags()); err != nil {
+					return
+				}
+			}
+			if err = c.setup(); err != nil {
+				return
+			}
+			ctx, cancel := c.context()
+			defer cancel()
+			return listParams(ctx, c)
+		},
 	}
+	jobFlags(paramsCmd.Flags(), &c)
+	completeJobFlags(paramsCmd, &c, &configFile)
+	paramsCmd.Flags().StringVarP(&c.Output, "output", "o", c.Output, "Output format, one of: text, json")
+	cmd.AddCommand(paramsCmd)
 
-	queueId, err := jenkins.BuildJob(context.Background(), c.Job.Name, c.Job.Params)
-	if err != nil {
-		return err
+	historyCount := 10
+	historyCmd := &cobra.Command{
+		Use:          "history",
+		Short:        "List the recent builds of the job",
+		Long:         historyDesc,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if configFile != "" {
+				if err = c.load(configFile, cmd.Flags()); err != nil {
+					return
+				}
+			}
+			if err = c.setup(); err != nil {
+				return
+			}
+			if historyCount <= 0 {
+				return fmt.Errorf("count must be greater than 0")
+			}
+			ctx, cancel := c.context()
+			defer cancel()
+			return listHistory(ctx, c, historyCount)
+		},
 	}
+	jobFlags(historyCmd.Flags(), &c)
+	completeJobFlags(historyCmd, &c, &configFile)
+	historyCmd.Flags().IntVarP(&historyCount, "count", "n", historyCount, "How many recent builds to list")
+	historyCmd.Flags().StringVarP(&c.Output, "output", "o", c.Output, "Output format, one of: text, json")
+	cmd.AddCommand(historyCmd)
 
-	fmt.Printf("Job %s triggered successfully\n", c.Job.Name)
-
-	if !c.Wait.Enabled {
-		return nil
+	rebuildCmd := &cobra.Command{
+		Use:          "rebuild",
+		Short:        "Trigger the job with the parameters of its last build",
+		Long:         rebuildDesc,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(cmd, true)
+		},
 	}
+	rebuildFlags := rebuildCmd.Flags()
+	jobFlags(rebuildFlags, &c)
+	completeJobFlags(rebuildCmd, &c, &configFile)
+	rebuildFlags.StringArrayVarP(&params.slice, "params", "p", params.slice, "The parameter in key=value format to override the one of the last build, can specify multiple times")
+	rebuildFlags.BoolVar(&c.Wait.Enabled, "wait", c.Wait.Enabled, "Wait for the job to complete, and return the results")
+	rebuildFlags.BoolVar(&c.Wait.ForStart, "wait-for-start", c.Wait.ForStart, "Wait for the build to leave the queue and start, and print the build URL without waiting for it to complete")
+	waitFlags(rebuildFlags, &c)
+	rebuildFlags.UintVar(&c.TriggerRetries, "trigger-retries", c.TriggerRetries, "How many times to retry triggering the job when the connection is refused or Jenkins responds 502/503/504")
+	rebuildFlags.BoolVar(&c.DryRun, "dry-run", c.DryRun, "Print the resolved request without connecting to Jenkins or triggering the job")
+	cmd.AddCommand(rebuildCmd)
 
-	return retry.Do(
-		pollBuildResult(c, jenkins, queueId),
-		retry.DelayType(retry.FixedDelay),
-		retry.Delay(c.Wait.PollTime),
-		retry.Attempts(c.Wait.MaxAttempts),
-	)
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCode(err))
+	}
 }
 
-func pollBuildResult(c config, jenkins *gojenkins.Jenkins, queueId int64) func() error {
-	return func() error {
-		fmt.Printf("Polling build result for job %s\n", c.Job.Name)
-
-		build, err := jenkins.GetBuildFromQueueID(context.Background(), queueId)
-		if err != nil {
-			return err
-		}
-
-		if build.IsGood(context.Background()) {
-			fmt.Printf("Job %s, build number %d successfully\n", c.Job.Name, build.GetBuildNumber())
-			return nil
+// bindEnv sets the flags which are not given on the command line from the environment variables named after them,
+// prefixed with envPrefix, e.g., JT_JENKINS_URL for --jenkins-url. The slice flags are split by commas as they are on the command line,
+// while the array flags, e.g., --params and --cookie, take the whole value as a single one
+func bindEnv(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed {
+			return
 		}
-
-		if build.IsRunning(context.Background()) {
-			fmt.Printf("Job %s, build number %d is still running, retry after %s\n", c.Job.Name, build.GetBuildNumber(), c.Wait.PollTime)
-			return &IsStillRunning{time.Now(), c.Job.Name, build.GetBuildNumber()}
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := os.LookupEnv(name); ok {
+			if e := flags.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("invalid environment variable %s: %w", name, e)
+			}
 		}
-
-		return retry.Unrecoverable(fmt.Errorf("Job %s Build number %d did not complete successfully\n", c.Job.Name, build.GetBuildNumber()))
-	}
-}
-
-// IsStillRunning indicate a Jenkins job is not done yet
-type IsStillRunning struct {
-	time        time.Time
-	jobName     string
-	buildNumber int64
+	})
+	return err
 }
 
-func (r *IsStillRunning) Error() string {
-	return fmt.Sprintf("job %s, build number %d is still running. (%s)\n", r.jobName, r.buildNumber, r.time.Format(time.Stamp))
+// jobFlags adds the flags of specifying the jobs to flags
+func jobFlags(flags *pflag.FlagSet, c *config) {
+	flags.StringSliceVarP(&c.Job.Names, "job", "j", c.Job.Names, "The name of the Jenkins job to run, can specify multiple or separate names with commas to run multiple jobs")
+	flags.StringSliceVar(&c.Job.Paths, "job-path", c.Job.Paths, "The slash-delimited path of the Jenkins job to run, the last segment is the job and the rest are folders, e.g., foo/bar/myjob, can specify multiple or separate paths with commas")
+	flags.StringArrayVarP(&c.Job.Folders, "job-folder", "f", c.Job.Folders, "The folder of the jobs of --job, outermost first, can specify multiple times for the nested folders, each is split by the folder separator unless --literal-folders is set")
+	flags.BoolVar(&c.Job.LiteralFolders, "literal-folders", c.Job.LiteralFolders, "Take each --job-folder verbatim as a single folder instead of splitting it by the folder separator, e.g., a folder name containing a slash")
+	flags.StringVar(&c.Job.FolderSeparator, "folder-separator", c.Job.FolderSeparator, "The separator of the folders and the job in --job-path, e.g., \\ for the paths from Windows")
+	flags.StringVar(&c.Job.Branch, "branch", c.Job.Branch, "The branch to run if the job is a multibranch pipeline, e.g., main or feature/foo")
 }
 
-type config struct {
-	Jenkins jenkins
-	Job     job
-	Wait    wait
-}
-
-type wait struct {
-	Enabled     bool
-	PollTime    time.Duration
-	MaxAttempts uint
+// paramsFlags adds the flags of the parameters of the jobs to flags
+func paramsFlags(flags *pflag.FlagSet, p *params) {
+	flags.StringArrayVarP(&p.slice, "params", "p", p.slice, "The parameter of the job in key=value format, can specify multiple times, the value may contain commas, e.g., 'message=hello, world'")
+	flags.StringVar(&p.delimiter, "params-delimiter", p.delimiter, "The separator of the keys and the values of --params and --params-csv, e.g., : for -p foo:bar, the parameters of --params-csv are split by commas first")
+	flags.StringSliceVar(&p.csv, "params-csv", p.csv, "The parameters of the job in key=value format separated with commas, e.g., foo=bar,baz=qux, quote the ones containing commas, can specify multiple times")
+	flags.StringVarP(&p.json, "params-json", "P", p.json, "The parameters of the job in JSON format, e.g., {\"foo\":\"bar\",\"baz\":\"qux\"}, or - to read from stdin")
+	flags.StringArrayVar(&p.bools, "bool-param", p.bools, "The boolean parameter of the job in key=value format, the value is one of: true, false, yes, no, on, off, 1, 0, and is sent as true or false, can specify multiple times")
+	flags.StringArrayVar(&p.choices, "choice-param", p.choices, "The choice parameter of the job in key=value format, the value is checked against the choices of the job before triggering, can specify multiple times")
+	flags.StringVar(&p.yaml, "params-yaml", p.yaml, "The parameters of the job in YAML format, e.g., '{foo: bar, baz: qux}', or - to read from stdin, the values must be scalars")
+	flags.StringArrayVar(&p.file, "params-file", p.file, "Path of the file to read the parameters of the job from, key=value pairs one per line, or a JSON object if the file has .json extension, or a YAML object if .yaml or .yml, can specify multiple times, the later files override the earlier ones")
+	flags.StringVar(&p.fileFormat, "params-file-format", p.fileFormat, "The format of --params-file, one of: json, yaml, properties, overrides the detection by the extension of the file, e.g., for a generated file")
+	flags.StringArrayVar(&p.env, "param-from-env", p.env, "The parameter of the job read from the environment variable in ENV=name format, or ENV if the parameter has the same name, append :-default to fall back to a default value, which may contain commas, e.g., BRANCH:-main, can specify multiple times")
+	flags.StringArrayVar(&p.files, "file-param", p.files, "The file parameter of the job in name=path format, the file is uploaded along with the other parameters, can specify multiple times")
+	flags.BoolVar(&p.expand, "expand-params", p.expand, "Expand the environment variables in the values of the parameters in $VAR or ${VAR} format, e.g., 'version=${GIT_TAG}-${BUILD_ID}', $$ is a literal $")
+	flags.BoolVar(&p.allowEmpty, "expand-params-allow-empty", p.allowEmpty, "Expand the undefined environment variables to empty with --expand-params, instead of rejecting them")
+	flags.BoolVar(&p.strict, "strict-params", p.strict, "Reject a parameter which is given by more than one source, instead of overriding by the precedence")
 }
 
-type jenkins struct {
-	Url      string
-	User     string
-	Pat      string
-	Insecure bool
-}
+// completionTimeout bounds querying Jenkins for the completions, so that the shell does not hang on an unreachable server
+const completionTimeout = 5 * time.Second
 
-func (j *jenkins) createClient() (*gojenkins.Jenkins, error) {
-	client := &http.Client{Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: j.Insecure},
-	}}
-	return gojenkins.CreateJenkins(client, j.Url, j.User, j.Pat).Init(context.Background())
+// completeJobFlags completes --job, --job-path and --job-folder of cmd with the items in Jenkins, the folders in
+// --job-path and --job-folder are completed with the folder separator appended to continue into them
+func completeJobFlags(cmd *cobra.Command, c *config, configFile *string) {
+	_ = cmd.RegisterFlagCompletionFunc("job", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return c.completeItems(cmd, *configFile, toComplete, false, func() ([]string, string) {
+			return c.folders(), ""
+		})
+	})
+	_ = cmd.RegisterFlagCompletionFunc("job-path", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return c.completeItems(cmd, *configFile, toComplete, false, func() ([]string, string) {
+			return nil, c.Job.FolderSeparator
+		})
+	})
+	_ = cmd.RegisterFlagCompletionFunc("job-folder", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return c.completeItems(cmd, *configFile, toComplete, true, func() ([]string, string) {
+			if c.Job.LiteralFolders {
+				return c.folders(), ""
+			}
+			return c.folders(), c.Job.FolderSeparator
+		})
+	})
 }
 
-type job struct {
-	Name   string
-	Params map[string]string
+// completeItems returns the completions of toComplete with the names of the items in Jenkins, only the folders if foldersOnly.
+// base returns the folders to list the items in, and the separator which toComplete is split by into more folders, if any.
+// The names before the last comma of toComplete are kept as is, since the job flags take comma-separated names.
+// Nothing is completed if Jenkins can not be queried, e.g., the URL or the credentials are not configured
+func (c *config) completeItems(cmd *cobra.Command, configFile, toComplete string, foldersOnly bool, base func() ([]string, string)) ([]string, cobra.ShellCompDirective) {
+	directive := cobra.ShellCompDirectiveNoFileComp
+	if configFile != "" {
+		if err := c.load(configFile, cmd.Flags()); err != nil {
+			return nil, directive
+		}
+	}
+	if err := bindEnv(cmd.Flags()); err != nil {
+		return nil, directive
+	}
+	folders, sep := base()
+	head := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 && !foldersOnly {
+		head, toComplete = toComplete[:i+1], toComplete[i+1:]
+	}
+	if i := strings.LastIndex(toComplete, sep); sep != "" && i >= 0 {
+		for _, segment := range strings.Split(toComplete[:i], sep) {
+			if segment != "" {
+				folders = append(folders, segment)
+			}
+		}
+		head, toComplete = head+toComplete[:i+len(sep)], toComplete[i+len(sep):]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	j := c.Jenkins
+	// only GET requests are sent, which need no crumb
+	j.NoCrumb = true
+	jenkins, err := j.CreateClient(ctx)
+	if err != nil {
+		return nil, directive
+	}
+	items, err := trigger.Items(ctx, jenkins, folders)
+	if err != nil {
+		return nil, directive
+	}
+	var completions []string
+	for _, item := range items {
+		switch {
+		case !strings.HasPrefix(item.Name, toComplete):
+		case item.Folder && sep != "":
+			completions = append(completions, head+item.Name+sep)
+			directive |= cobra.ShellCompDirectiveNoSpace
+		case item.Folder || !foldersOnly:
+			completions = append(completions, head+item.Name)
+		}
+	}
+	return completions, directive
 }
 
-type params struct {
-	slice []string
-	json  string
+// waitFlags adds the flags of waiting for the builds to flags
+func waitFlags(flags *pflag.FlagSet, c *config) {
+	flags.DurationVar(&c.Wait.PollTime, "poll-time", c.Wait.PollTime, "How often (duration) to poll the Jenkins server for results, at least 1s")
+	flags.UintVar(&c.Wait.MaxAttempts, "max-attempts", c.Wait.MaxAttempts, "Max count of polling for results, must be greater than 0")
+	flags.StringVar(&c.Wait.Backoff, "backoff", c.Wait.Backoff, "How the polling interval grows, one of: fixed, exponential")
+	flags.DurationVar(&c.Wait.MaxPollTime, "max-poll-time", c.Wait.MaxPollTime, "The upper bound (duration) of the polling interval when using exponential backoff")
+	flags.Float64Var(&c.Wait.Jitter, "jitter", c.Wait.Jitter, "The fraction (0 to 1) of the polling interval to randomize each interval by, e.g., 0.2 is ±20%, 0 means none")
+	flags.DurationVar(&c.Timeout, "timeout", c.Timeout, "Overall deadline (duration) of triggering and waiting for the job, 0 means no deadline")
+	flags.DurationVar(&c.Wait.QueueTimeout, "queue-timeout", c.Wait.QueueTimeout, "How long (duration) the build can stay in the queue before it's cancelled when waiting, 0 means no limit")
+	flags.DurationVar(&c.Wait.AbortAfter, "abort-after", c.Wait.AbortAfter, "How long (duration) the build can keep running before it's aborted and reported as ABORTED when waiting, 0 means no limit")
+	flags.BoolVar(&c.Wait.Downstream, "wait-downstream", c.Wait.Downstream, "Wait for the downstream builds caused by the build as well, recursively, and fail if any one of them fails, implies --wait")
+	flags.BoolVar(&c.Wait.FailOnUnstable, "fail-on-unstable", c.Wait.FailOnUnstable, "Treat an UNSTABLE build as failed when waiting")
+	flags.StringSliceVar(&c.Wait.AcceptResults, "accept-results", c.Wait.AcceptResults, "The results which count as passed when waiting, one or more of: SUCCESS, UNSTABLE, FAILURE, ABORTED, NOT_BUILT, separated with commas, e.g., SUCCESS,ABORTED, defaults to SUCCESS and UNSTABLE")
+	flags.StringVar(&c.Artifacts.Pattern, "download-artifact", c.Artifacts.Pattern, "Download the artifacts matching the glob against the relative path or the file name once the build is completed successfully, e.g., '*.jar'")
+	flags.StringVar(&c.Artifacts.Dir, "output-dir", c.Artifacts.Dir, "The directory to save the downloaded artifacts to, the relative paths of the artifacts are kept")
+	flags.BoolVar(&c.TestReport.Enabled, "test-report", c.TestReport.Enabled, "Print the total, failed and skipped counts of the test results once the build is completed")
+	flags.BoolVar(&c.TestReport.ListFailed, "list-failed-tests", c.TestReport.ListFailed, "Print the names of the failed tests, implies --test-report")
+	flags.BoolVar(&c.TestReport.FailOnFailures, "fail-on-test-failures", c.TestReport.FailOnFailures, "Exit 2 if any test failed even if the result of the build is SUCCESS, implies --test-report")
+	flags.UintVar(&c.Wait.FailLogLines, "fail-log-lines", c.Wait.FailLogLines, "How many lines at the end of the console output are printed to stderr if the build did not succeed, 0 means none")
+	flags.BoolVar(&c.Wait.FollowLogs, "follow-logs", c.Wait.FollowLogs, "Print the console output of the build while waiting")
+	flags.Int64Var(&c.Wait.FollowFrom, "from-byte", c.Wait.FollowFrom, "The byte offset of the console output to start following the logs from, requires --follow-logs")
+	flags.BoolVar(&c.followTail, "tail", c.followTail, "Follow the logs from the end of the console output so far instead of the beginning, requires --follow-logs")
+	flags.Int64Var(&c.Wait.MaxLogBytes, "max-log-bytes", c.Wait.MaxLogBytes, "Stop streaming the console output of the build to the terminal and --log-file once it exceeds this many bytes, still waiting for the result, 0 means no limit")
+	flags.StringVar(&c.Wait.LogFile, "log-file", c.Wait.LogFile, "Path of the file to write the full console output of the build to as it streams while waiting, regardless of --follow-logs, e.g., to archive the build log")
+	flags.StringVar(&c.NotifyUrl, "notify-url", c.NotifyUrl, "The URL of the webhook to POST a JSON object to when the build starts and when it finishes while waiting, e.g., a Slack incoming webhook")
+	flags.BoolVar(&c.Wait.NoAbortOnSignal, "no-abort-on-signal", c.Wait.NoAbortOnSignal, "Do not abort the builds when receiving SIGINT/SIGTERM while waiting")
+	flags.StringVarP(&c.Output, "output", "o", c.Output, "Output format, one of: text, json, jsonl, url. In json format, the results are printed to stdout as JSON objects, in jsonl format, the events of each step are printed to stdout as JSON lines, in url format, the URLs of the builds, or of the queue items if the builds are unknown, are printed to stdout, and the progress is printed to stderr in all of them")
+	flags.StringVar(&c.OutputTemplate, "output-template", c.OutputTemplate, "The Go text/template to print each result to stdout with, followed by a newline, e.g., '{{.BuildNumber}} {{.Result}}', the progress is printed to stderr")
+	flags.StringVar(&c.ResultFile, "result-file", c.ResultFile, "Path of the file to write the results to as a JSON document once the jobs are done, even if they failed, along with the errors")
+	flags.BoolVar(&c.IgnoreResult, "ignore-result", c.IgnoreResult, "Exit 0 even if the builds did not succeed or the waiting gave up, the result is still printed")
+	flags.BoolVarP(&c.Quiet, "quiet", "q", c.Quiet, "Suppress the progress output, only errors and the results in json format are printed")
 }
 
-func (p *params) init() (map[string]string, error) {
-	params := make(map[string]string)
-	if p.json != "" {
-		if err := json.Unmarshal([]byte(p.json), &params); err != nil {
-			return nil, err
+// setup validates the settings shared by the commands, and sets up where and how the progress is logged
+func (c *config) setup() error {
+	if c.followTail && c.Wait.FollowFrom != 0 {
+		return fmt.Errorf("--tail and --from-byte can not be used together")
+	}
+	if c.Wait.FollowFrom < 0 {
+		return fmt.Errorf("invalid from byte %d, must not be negative", c.Wait.FollowFrom)
+	}
+	if c.followTail {
+		c.Wait.FollowFrom = trigger.FollowFromEnd
+	}
+	if c.Wait.FollowFrom != 0 && (!c.Wait.FollowLogs || c.Wait.LogFile != "") {
+		return fmt.Errorf("--tail and --from-byte require --follow-logs, and can not be used along with --log-file, which contains the complete console output")
+	}
+	if len(c.Wait.AcceptResults) > 0 && c.Wait.FailOnUnstable {
+		return fmt.Errorf("--accept-results and --fail-on-unstable can not be used together, leave UNSTABLE out of --accept-results instead")
+	}
+	for _, result := range c.Wait.AcceptResults {
+		valid := false
+		for _, r := range buildResults {
+			valid = valid || strings.EqualFold(r, result)
+		}
+		if !valid {
+			return fmt.Errorf("invalid accepted result %q, must be one of: %s", result, strings.Join(buildResults, ", "))
 		}
 	}
-	for _, v := range p.slice {
-		split := strings.Split(v, "=")
-		params[split[0]] = strings.Join(split[1:], "=")
+	if c.TestReport.ListFailed || c.TestReport.FailOnFailures {
+		c.TestReport.Enabled = true
 	}
-	return params, nil
+	if c.Wait.Enabled && c.Wait.PollTime < minWaitPollTime {
+		return fmt.Errorf("invalid poll time %s, must be at least %s", c.Wait.PollTime, minWaitPollTime)
+	}
+	if c.Wait.Enabled && c.Wait.MaxAttempts == 0 {
+		return fmt.Errorf("invalid max attempts 0, must be greater than 0")
+	}
+	if c.Wait.Backoff != trigger.BackoffFixed && c.Wait.Backoff != trigger.BackoffExponential {
+		return fmt.Errorf("invalid backoff %q, must be one of: %s, %s", c.Wait.Backoff, trigger.BackoffFixed, trigger.BackoffExponential)
+	}
+	if c.Wait.Backoff == trigger.BackoffExponential && c.Wait.MaxPollTime <= 0 {
+		return fmt.Errorf("max poll time must be positive when using %s backoff", trigger.BackoffExponential)
+	}
+	if c.Wait.MaxLogBytes < 0 {
+		return fmt.Errorf("invalid max log bytes %d, must not be negative", c.Wait.MaxLogBytes)
+	}
+	if c.Wait.Jitter < 0 || c.Wait.Jitter > 1 {
+		return fmt.Errorf("invalid jitter %v, must be between 0 and 1", c.Wait.Jitter)
+	}
+	switch c.Output {
+	case outputText:
+	case outputJson, outputJsonl, outputUrl:
+		progress = os.Stderr
+	default:
+		return fmt.Errorf("invalid output format %q, must be one of: %s, %s, %s, %s", c.Output, outputText, outputJson, outputJsonl, outputUrl)
+	}
+	if c.OutputTemplate != "" {
+		if c.Output != outputText {
+			return fmt.Errorf("--output-template and --output %s can not be used together", c.Output)
+		}
+		t, err := template.New("output").Option("missingkey=error").Parse(c.OutputTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid output template: %w", err)
+		}
+		c.outputTemplate = t
+		progress = os.Stderr
+	}
+	if c.NotifyUrl != "" {
+		transport, err := c.Jenkins.Transport()
+		if err != nil {
+			return err
+		}
+		// the webhook is another server than Jenkins, whose certificate is verified against its own hostname
+		transport.TLSClientConfig.ServerName = ""
+		c.notifyClient = &http.Client{Transport: transport, Timeout: notifyTimeout}
+	}
+	level, err := trigger.ParseLevel(c.LogLevel)
+	if err != nil {
+		return err
+	}
+	w := progress
+	if c.Quiet {
+		// only the errors are logged, to stderr
+		w, progress = os.Stderr, io.Discard
+		if level < trigger.LevelError {
+			level = trigger.LevelError
+		}
+	}
+	color, err := c.color(w)
+	if err != nil {
+		return err
+	}
+	if logger, err = trigger.NewLogger(w, level, c.LogFormat, color); err != nil {
+		return err
+	}
+	c.Jenkins.Logger = logger
+	if c.Jenkins.Url, err = trigger.NormalizeUrl(c.Jenkins.Url); err != nil {
+		return err
+	}
+	if c.Jenkins.Insecure && c.Jenkins.CaCert != "" {
+		logger.Warn("--insecure is set, --ca-cert is ignored")
+	}
+	if c.Jenkins.Insecure && c.Jenkins.TlsServerName != "" {
+		logger.Warn("--insecure is set, --tls-server-name is ignored")
+	}
+	return nil
+}
+
+// color reports whether to color the progress written to w by c.Color
+func (c *config) color(w io.Writer) (bool, error) {
+	switch c.Color {
+	case colorAlways:
+		return true, nil
+	case colorNever:
+		return false, nil
+	case colorAuto:
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		f, ok := w.(*os.File)
+		if !ok {
+			return false, nil
+		}
+		stat, err := f.Stat()
+		return err == nil && stat.Mode()&os.ModeCharDevice != 0, nil
+	default:
+		return false, fmt.Errorf("invalid color %q, must be one of: %s, %s, %s", c.Color, colorAuto, colorAlways, colorNever)
+	}
+}
+
+// context returns the context of running the command, which is canceled on the first SIGINT/SIGTERM when waiting,
+// and has a deadline if c.Timeout is set
+func (c *config) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if c.Wait.Enabled && !c.Wait.NoAbortOnSignal {
+		handleSignals(cancel)
+	}
+	if c.Timeout <= 0 {
+		return ctx, cancel
+	}
+	ctx, cancelTimeout := context.WithTimeout(ctx, c.Timeout)
+	return ctx, func() {
+		cancelTimeout()
+		cancel()
+	}
+}
+
+// handleSignals calls cancel on the first SIGINT/SIGTERM so that the builds being waited are aborted,
+// and force exits on the second one
+func handleSignals(cancel context.CancelFunc) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		logger.Info(fmt.Sprintf("Received %s, aborting the builds, send again to force exit", sig))
+		cancel()
+		<-sigs
+		os.Exit(exitError)
+	}()
+}
+
+// exitCode maps err to the exit code of the process
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, trigger.ErrBuildFailed):
+		return exitBuildFailed
+	case errors.Is(err, trigger.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		// the deadline of --timeout may pass before waiting, e.g., while triggering or in the queue
+		return exitTimeout
+	case errors.Is(err, trigger.ErrDisabled):
+		return exitDisabled
+	default:
+		return exitError
+	}
+}
+
+// ping connects to the Jenkins server and prints the version and the authenticated user
+func ping(ctx context.Context, c config) error {
+	c.Jenkins.NoInit = false
+	jenkins, err := c.Jenkins.CreateClient(ctx)
+	if err != nil {
+		return err
+	}
+	user := struct {
+		Id       string `json:"id"`
+		FullName string `json:"fullName"`
+	}{}
+	if _, err := jenkins.Requester.GetJSON(ctx, "/me", &user, nil); err != nil {
+		return fmt.Errorf("failed to get the authenticated user: %w", err)
+	}
+	logger.Info(fmt.Sprintf("Connected to Jenkins %s, version: %s, user: %s (%s)", jenkins.Server, jenkins.Version, user.Id, user.FullName))
+	return nil
+}
+
+// listParams prints the parameter definitions of the job
+func listParams(ctx context.Context, c config) error {
+	jobs, err := c.jobs()
+	if err != nil {
+		return err
+	}
+	if len(jobs) != 1 {
+		return fmt.Errorf("exactly one job is required, but got %d", len(jobs))
+	}
+	jenkins, err := c.Jenkins.CreateClient(ctx)
+	if err != nil {
+		return err
+	}
+	j := c.trigger(jobs[0]).Job
+	params, err := trigger.Parameters(ctx, jenkins, j)
+	if err != nil {
+		return err
+	}
+	if c.Output != outputText {
+		return json.NewEncoder(os.Stdout).Encode(params)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tDEFAULT\tCHOICES\tDESCRIPTION")
+	for _, p := range params {
+		def := ""
+		if p.Default != nil {
+			def = fmt.Sprint(p.Default)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Name, strings.TrimSuffix(p.Type, "ParameterDefinition"), def, strings.Join(p.Choices, ","), strings.ReplaceAll(p.Description, "\n", " "))
+	}
+	return w.Flush()
+}
+
+// listHistory prints the last n builds of the job
+func listHistory(ctx context.Context, c config, n int) error {
+	jobs, err := c.jobs()
+	if err != nil {
+		return err
+	}
+	if len(jobs) != 1 {
+		return fmt.Errorf("exactly one job is required, but got %d", len(jobs))
+	}
+	jenkins, err := c.Jenkins.CreateClient(ctx)
+	if err != nil {
+		return err
+	}
+	builds, err := trigger.History(ctx, jenkins, c.trigger(jobs[0]).Job, n)
+	if err != nil {
+		return err
+	}
+	if c.Output != outputText {
+		return json.NewEncoder(os.Stdout).Encode(builds)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NUMBER\tRESULT\tSTARTED\tDURATION\tURL")
+	for _, b := range builds {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", b.Number, b.Result, b.Started.Format(time.RFC3339), b.Duration, b.Url)
+	}
+	return w.Flush()
+}
+
+// waitBuilds waits for the builds of the queue items of queueIds concurrently, the jobs are resolved from the queue items.
+// The console output of each job is prefixed with its name if waiting for more than one queue item
+func waitBuilds(ctx context.Context, c config, queueIds []int64) error {
+	if c.Wait.LogFile != "" && len(queueIds) > 1 {
+		return fmt.Errorf("--log-file can only be used with a single queue item, the console outputs of the builds would be mixed")
+	}
+	results := make([]trigger.Result, len(queueIds))
+	failures := make([]error, len(queueIds))
+	for i, queueId := range queueIds {
+		results[i].QueueId = queueId
+	}
+	jenkins, err := c.Jenkins.CreateClient(ctx)
+	if err != nil {
+		for i := range failures {
+			failures[i] = err
+		}
+		if err := c.writeResultFile(results, failures); err != nil {
+			return err
+		}
+		return err
+	}
+	closeLog, err := c.openLogFile()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	if len(queueIds) == 1 {
+		failures[0] = c.waitBuild(ctx, jenkins, &results[0], false)
+	} else {
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Add(1)
+			go func(r *trigger.Result, err *error) {
+				defer wg.Done()
+				*err = c.waitBuild(ctx, jenkins, r, true)
+			}(&results[i], &failures[i])
+		}
+		wg.Wait()
+	}
+
+	var errs JobsFailed
+	for _, err := range failures {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.writeResultFile(results, failures); err != nil {
+		return err
+	}
+	if err := c.print(results); err != nil {
+		return err
+	}
+	if len(results) > 1 && !c.Quiet {
+		if err := summarize(os.Stderr, results); err != nil {
+			return err
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// waitBuild waits for the build of the queue item of r.QueueId, the console output is prefixed with the name of the job if prefixed
+func (c *config) waitBuild(ctx context.Context, jenkins *gojenkins.Jenkins, r *trigger.Result, prefixed bool) error {
+	j, err := trigger.JobOfQueueItem(ctx, jenkins, r.QueueId)
+	if err != nil {
+		return err
+	}
+	r.Job = j.FullName()
+	tc := c.trigger(j)
+	if prefixed {
+		prefix := "[" + j.FullName() + "] "
+		console, failLog := &prefixWriter{w: tc.Progress, prefix: prefix}, &prefixWriter{w: tc.FailLog, prefix: prefix}
+		defer console.flush()
+		defer failLog.flush()
+		tc.Progress, tc.FailLog = console, failLog
+	}
+	logger.Info(fmt.Sprintf("Waiting for job %s, queue item %d", r.Job, r.QueueId))
+	return trigger.WaitFor(ctx, jenkins, tc, r)
+}
+
+func triggerBuild(ctx context.Context, c config) error {
+	jobs, err := c.jobs()
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(jobs))
+	for i, j := range jobs {
+		names[i] = j.FullName()
+	}
+	// only the keys of the parameters are logged, the values may be secrets, e.g., read by --param-from-env
+	keys := make([]string, 0, len(c.Job.Params))
+	for k := range c.Job.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	logger.Info(fmt.Sprintf("Triggering Jenkins build for jobs: %v, parameters: %v, wait: %+v", names, keys, c.Wait))
+	if c.Wait.LogFile != "" && len(jobs) > 1 {
+		return fmt.Errorf("--log-file can only be used with a single job, the console outputs of the builds would be mixed")
+	}
+
+	if c.DryRun {
+		for _, j := range jobs {
+			tc := c.trigger(j)
+			logger.Info(fmt.Sprintf("Dry run, job %s would be triggered at %s with parameters: %v", tc.Job.FullName(), strings.TrimSuffix(c.Jenkins.Url, "/")+tc.Job.Path(), tc.Job.Params))
+			if tc.Job.ParamsFromBuild == trigger.LastBuild {
+				logger.Info(fmt.Sprintf("Dry run, job %s would copy the other parameters from the last build", tc.Job.FullName()))
+			} else if tc.Job.ParamsFromBuild > 0 {
+				logger.Info(fmt.Sprintf("Dry run, job %s would copy the other parameters from build number %d", tc.Job.FullName(), tc.Job.ParamsFromBuild))
+			}
+			if len(tc.Job.Files) > 0 {
+				logger.Info(fmt.Sprintf("Dry run, job %s would be triggered with files: %v", tc.Job.FullName(), tc.Job.Files))
+			}
+		}
+		return nil
+	}
+
+	var errs JobsFailed
+	results := make([]trigger.Result, len(jobs))
+	// failures are the errors of the jobs by index, nil if the job succeeded
+	failures := make([]error, len(jobs))
+	for i, j := range jobs {
+		results[i].Job = j.FullName()
+	}
+
+	jenkins, err := c.Jenkins.CreateClient(ctx)
+	if err != nil {
+		for i := range failures {
+			failures[i] = err
+		}
+		if err := c.writeResultFile(results, failures); err != nil {
+			return err
+		}
+		return err
+	}
+
+	if c.Wait.Enabled {
+		closeLog, err := c.openLogFile()
+		if err != nil {
+			return err
+		}
+		defer closeLog()
+	}
+	// canceled on the first failure with --fail-fast, which aborts the builds being waited for
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if c.Parallel > 1 {
+		c.runParallel(runCtx, cancel, jenkins, jobs, results, failures)
+	} else {
+		c.runSequential(runCtx, cancel, jenkins, jobs, results, failures)
+	}
+	// the jobs aborted by --fail-fast follow the ones which actually failed
+	var aborted JobsFailed
+	for i, err := range failures {
+		switch {
+		case err == nil || err == errSkipped:
+		case errors.Is(err, context.Canceled) && ctx.Err() == nil:
+			failures[i] = fmt.Errorf("%w, since another job failed with --fail-fast", err)
+			aborted = append(aborted, failures[i])
+		default:
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, aborted...)
+
+	if err := c.writeResultFile(results, failures); err != nil {
+		return err
+	}
+	if err := c.print(results); err != nil {
+		return err
+	}
+	if len(results) > 1 && !c.Quiet {
+		if err := summarize(os.Stderr, results); err != nil {
+			return err
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// errSkipped is the failure of the jobs which are not triggered, since another job failed with --fail-fast
+var errSkipped = errors.New("not triggered, since another job failed with --fail-fast")
+
+// runSequential triggers all the jobs, and then waits for them one by one if waiting.
+// The results and the errors of the jobs are set by index, cancel is called on the first failure with --fail-fast
+func (c *config) runSequential(ctx context.Context, cancel context.CancelFunc, jenkins *gojenkins.Jenkins, jobs []trigger.Job, results []trigger.Result, failures []error) {
+	failed := false
+	for i, j := range jobs {
+		if failed && c.FailFast {
+			failures[i] = errSkipped
+			continue
+		}
+		var err error
+		if results[i], err = trigger.Start(ctx, jenkins, c.trigger(j)); err != nil {
+			failures[i], failed = err, true
+		}
+	}
+	if failed && c.FailFast {
+		cancel()
+	}
+	if !c.Wait.Enabled {
+		return
+	}
+	for i := range results {
+		if results[i].QueueId == 0 {
+			continue
+		}
+		if err := trigger.WaitFor(ctx, jenkins, c.trigger(jobs[i]), &results[i]); err != nil {
+			failures[i] = err
+			if c.FailFast {
+				cancel()
+			}
+		}
+	}
+}
+
+// runParallel triggers and waits for up to c.Parallel jobs concurrently, the console output of each job is prefixed
+// with its name. The results and the errors of the jobs are set by index, cancel is called on the first failure with --fail-fast
+func (c *config) runParallel(ctx context.Context, cancel context.CancelFunc, jenkins *gojenkins.Jenkins, jobs []trigger.Job, results []trigger.Result, failures []error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := false
+	sem := make(chan struct{}, c.Parallel)
+	for i, j := range jobs {
+		sem <- struct{}{}
+		mu.Lock()
+		skip := failed && c.FailFast
+		mu.Unlock()
+		if skip {
+			failures[i] = errSkipped
+			<-sem
+			continue
+		}
+		wg.Add(1)
+		go func(i int, j trigger.Job) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			tc := c.trigger(j)
+			prefix := "[" + j.FullName() + "] "
+			console, failLog := &prefixWriter{w: tc.Progress, prefix: prefix}, &prefixWriter{w: tc.FailLog, prefix: prefix}
+			defer console.flush()
+			defer failLog.flush()
+			tc.Progress, tc.FailLog = console, failLog
+			r, err := trigger.Start(ctx, jenkins, tc)
+			if err == nil && c.Wait.Enabled && !r.Skipped {
+				err = trigger.WaitFor(ctx, jenkins, tc, &r)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			results[i], failures[i] = r, err
+			if err != nil {
+				failed = true
+				if c.FailFast {
+					cancel()
+				}
+			}
+		}(i, j)
+	}
+	wg.Wait()
+}
+
+// writeMu serializes the lines written by the prefixWriters
+var writeMu sync.Mutex
+
+// prefixWriter prefixes each line written to w, the lines are written as a whole, so that the lines of the jobs
+// running in parallel are not interleaved
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	i := bytes.LastIndexByte(p.buf, '\n')
+	if i < 0 {
+		return len(b), nil
+	}
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(p.buf[:i+1], []byte("\n")) {
+		if len(line) > 0 {
+			out.WriteString(p.prefix)
+			out.Write(line)
+		}
+	}
+	p.buf = append(p.buf[:0], p.buf[i+1:]...)
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	if _, err := p.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// flush writes the last line which is not terminated by a newline
+func (p *prefixWriter) flush() {
+	if len(p.buf) > 0 {
+		p.Write([]byte("\n"))
+	}
+}
+
+// print prints the results to stdout in json or url format, the URL is of the build if it's known, or of the queue item
+func (c *config) print(results []trigger.Result) error {
+	enc := json.NewEncoder(os.Stdout)
+	for _, r := range results {
+		switch {
+		case c.outputTemplate != nil:
+			if err := c.outputTemplate.Execute(os.Stdout, r); err != nil {
+				return fmt.Errorf("failed to print the result of job %s with the output template: %w", r.Job, err)
+			}
+			fmt.Println()
+		case c.Output == outputJson:
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		case c.Output == outputUrl && r.Url != "":
+			fmt.Println(r.Url)
+		case c.Output == outputUrl && r.QueueUrl != "":
+			fmt.Println(r.QueueUrl)
+		}
+	}
+	return nil
+}
+
+// openLogFile creates c.Wait.LogFile to write the console output of the build to if it's set,
+// and returns the function to close it
+func (c *config) openLogFile() (func(), error) {
+	if c.Wait.LogFile == "" {
+		return func() {}, nil
+	}
+	f, err := os.Create(c.Wait.LogFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log file %s: %w", c.Wait.LogFile, err)
+	}
+	c.consoleLog = f
+	return func() {
+		if err := f.Close(); err != nil {
+			logger.Error(fmt.Sprintf("failed to close log file %s: %s", c.Wait.LogFile, err))
+		}
+		c.consoleLog = nil
+	}, nil
+}
+
+// writeResultFile writes the results along with the errors of the jobs to c.ResultFile as a JSON document,
+// if it's set
+func (c *config) writeResultFile(results []trigger.Result, errs []error) error {
+	if c.ResultFile == "" {
+		return nil
+	}
+	type jobResult struct {
+		trigger.Result
+		Error string `json:"error,omitempty"`
+	}
+	doc := struct {
+		Results []jobResult `json:"results"`
+	}{Results: make([]jobResult, len(results))}
+	for i, r := range results {
+		doc.Results[i].Result = r
+		if errs[i] != nil {
+			doc.Results[i].Error = errs[i].Error()
+		}
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.ResultFile, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write result file %s: %w", c.ResultFile, err)
+	}
+	return nil
+}
+
+// summarize prints the results of the jobs as a table to w, the unknown fields, e.g., the job of a queue item not found, are printed as -
+func summarize(w io.Writer, results []trigger.Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB\tBUILD\tRESULT\tDURATION\tURL")
+	dash := func(v string) string {
+		if v == "" {
+			return "-"
+		}
+		return v
+	}
+	for _, r := range results {
+		build := ""
+		if r.BuildNumber > 0 {
+			build = strconv.FormatInt(r.BuildNumber, 10)
+		}
+		u := r.Url
+		if u == "" {
+			u = r.QueueUrl
+		}
+		result := r.Result
+		if r.Skipped {
+			result = "SKIPPED"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", dash(r.Job), dash(build), dash(result), dash(r.Duration), dash(u))
+	}
+	return tw.Flush()
+}
+
+// JobsFailed collects the errors of multiple jobs, it unwraps to the error of the first failed job
+type JobsFailed []error
+
+func (e JobsFailed) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e JobsFailed) Unwrap() error {
+	return e[0]
+}
+
+type config struct {
+	Jenkins        trigger.Jenkins    `yaml:"jenkins"`
+	Job            job                `yaml:"job"`
+	Wait           wait               `yaml:"wait"`
+	Artifacts      trigger.Artifacts  `yaml:"artifacts"`
+	TestReport     trigger.TestReport `yaml:"test-report"`
+	TriggerRetries uint               `yaml:"trigger-retries"`
+	Timeout        time.Duration      `yaml:"timeout"`
+	DryRun         bool               `yaml:"dry-run"`
+	Output         string             `yaml:"output"`
+	Parallel       uint               `yaml:"parallel"`
+	FailFast       bool               `yaml:"fail-fast"`
+	ResultFile     string             `yaml:"result-file"`
+	Quiet          bool               `yaml:"quiet"`
+	IgnoreResult   bool               `yaml:"ignore-result"`
+	LogLevel       string             `yaml:"log-level"`
+	LogFormat      string             `yaml:"log-format"`
+	Color          string             `yaml:"color"`
+	// NotifyUrl is the URL of the webhook to notify when the build starts and finishes, which is not logged
+	NotifyUrl string `yaml:"notify-url"`
+	// OutputTemplate is the Go text/template to print each result with instead of Output
+	OutputTemplate string `yaml:"output-template"`
+	// outputTemplate is the parsed OutputTemplate
+	outputTemplate *template.Template
+	// consoleLog is the opened LogFile of waiting
+	consoleLog io.Writer
+	// followTail follows the logs from the end, which sets Wait.FollowFrom to trigger.FollowFromEnd
+	followTail bool
+	// notifyClient posts to NotifyUrl through the proxy and with the TLS config of Jenkins
+	notifyClient *http.Client
+}
+
+// buildResults are the results of the completed builds
+var buildResults = []string{"SUCCESS", "UNSTABLE", "FAILURE", "ABORTED", "NOT_BUILT"}
+
+// redacted returns a copy of c with the secrets redacted, i.e., the PAT, the build token, the values of the cookies
+// and the headers, and the notify URL
+func (c config) redacted() config {
+	if c.Jenkins.Pat != "" {
+		c.Jenkins.Pat = redacted
+	}
+	if c.Job.BuildToken != "" {
+		c.Job.BuildToken = redacted
+	}
+	cookies := make([]string, len(c.Jenkins.Cookies))
+	for i, cookie := range c.Jenkins.Cookies {
+		name, _, err := splitKeyValue(cookie)
+		if err != nil {
+			name = cookie
+		}
+		cookies[i] = name + "=" + redacted
+	}
+	c.Jenkins.Cookies = cookies
+	headers := make([]string, len(c.Jenkins.Headers))
+	for i, header := range c.Jenkins.Headers {
+		name := header
+		if j := strings.Index(header, ":"); j >= 0 {
+			name = header[:j]
+		}
+		headers[i] = name + ": " + redacted
+	}
+	c.Jenkins.Headers = headers
+	if c.NotifyUrl != "" {
+		c.NotifyUrl = redacted
+	}
+	return c
+}
+
+// dump writes c to stdout in format, one of: yaml, json, the keys of JSON are the same as the ones of YAML
+func (c config) dump(format string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	switch format {
+	case configFormatYaml:
+		_, err = os.Stdout.Write(data)
+		return err
+	case configFormatJson:
+		var v map[string]interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("failed to encode config: %w", err)
+		}
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	default:
+		return fmt.Errorf("invalid config format %q, must be one of: %s, %s", format, configFormatYaml, configFormatJson)
+	}
+}
+
+// result returns err, unless c.IgnoreResult is set and err is all about the result of the builds,
+// i.e., the builds did not succeed or the waiting gave up, which is then only printed
+func (c *config) result(err error) error {
+	if err == nil || !c.IgnoreResult {
+		return err
+	}
+	errs, ok := err.(JobsFailed)
+	if !ok {
+		errs = JobsFailed{err}
+	}
+	for _, e := range errs {
+		// e.g., a disabled job still exits 4
+		if code := exitCode(e); code != exitBuildFailed && code != exitTimeout {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Ignoring the result: %s\n", err)
+	return nil
+}
+
+// jobs returns the jobs given by the names, followed by the ones given by the paths
+func (c *config) jobs() ([]trigger.Job, error) {
+	var jobs []trigger.Job
+	if c.Job.FolderSeparator == "" {
+		return nil, fmt.Errorf("folder separator can not be empty")
+	}
+	if len(c.Job.Folders) > 0 && len(c.Job.Names) == 0 {
+		return nil, fmt.Errorf("--job-folder requires --job, the folders of --job-path are given in the path")
+	}
+	folders := c.folders()
+	for _, name := range c.Job.Names {
+		jobs = append(jobs, trigger.Job{Name: name, Folders: folders})
+	}
+	for _, path := range c.Job.Paths {
+		var segments []string
+		for _, segment := range strings.Split(path, c.Job.FolderSeparator) {
+			if segment != "" {
+				segments = append(segments, segment)
+			}
+		}
+		if len(segments) == 0 {
+			return nil, fmt.Errorf("invalid job path %q, must be in folder%[2]s...%[2]sjob format", path, c.Job.FolderSeparator)
+		}
+		jobs = append(jobs, trigger.Job{Name: segments[len(segments)-1], Folders: segments[:len(segments)-1]})
+	}
+	return jobs, nil
+}
+
+// folders returns the folders of --job-folder, each is split by the folder separator unless LiteralFolders is set
+func (c *config) folders() []string {
+	var folders []string
+	for _, folder := range c.Job.Folders {
+		if c.Job.LiteralFolders {
+			folders = append(folders, folder)
+			continue
+		}
+		for _, segment := range strings.Split(folder, c.Job.FolderSeparator) {
+			if segment != "" {
+				folders = append(folders, segment)
+			}
+		}
+	}
+	return folders
+}
+
+// trigger returns the configuration of triggering the job j
+func (c *config) trigger(j trigger.Job) trigger.Config {
+	j.Branch = c.Job.Branch
+	j.Params = c.Job.Params
+	j.CorrelationKey = c.Job.correlationKey
+	j.VerifyCorrelation = c.Job.verifyCorrelation
+	j.ValidateParams = c.Job.ValidateParams
+	j.Cause = c.Job.Cause
+	j.Files = c.Job.Files
+	j.Choices = c.Job.Choices
+	j.ParamsFromBuild = c.Job.ParamsFromBuild
+	j.IfNotBuilding = c.Job.IfNotBuilding
+	j.ForceWithParameters = c.Job.ForceWithParameters
+	j.EnableIfDisabled = c.Job.EnableIfDisabled
+	j.BuildToken = c.Job.BuildToken
+	tc := trigger.Config{
+		Jenkins:        c.Jenkins,
+		Job:            j,
+		Wait:           c.Wait.Wait,
+		Artifacts:      c.Artifacts,
+		TestReport:     c.TestReport,
+		TriggerRetries: c.TriggerRetries,
+		Timeout:        c.Timeout,
+		Logger:         logger,
+		Progress:       progress,
+		FailLog:        os.Stderr,
+		ConsoleLog:     c.consoleLog,
+	}
+	if c.Output == outputJsonl {
+		tc.OnEvent = printEvent
+	}
+	if c.NotifyUrl != "" {
+		notify := notifier(c.notifyClient, c.NotifyUrl, c.Wait.ForStart)
+		if print := tc.OnEvent; print != nil {
+			tc.OnEvent = func(e trigger.Event) {
+				print(e)
+				notify(e)
+			}
+		} else {
+			tc.OnEvent = notify
+		}
+	}
+	return tc
+}
+
+// notification is the JSON object posted to --notify-url
+type notification struct {
+	Job         string `json:"job"`
+	BuildNumber int64  `json:"buildNumber,omitempty"`
+	// Status is either started or finished
+	Status string `json:"status"`
+	Url    string `json:"url,omitempty"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Text describes the notification in a sentence, which is what Slack and Teams incoming webhooks display
+	Text string `json:"text"`
+}
+
+// notifier returns the event handler which notifies webhook once the build is started, and once the waiting is completed
+// unless it only waits for the start
+func notifier(client *http.Client, webhook string, forStart bool) func(trigger.Event) {
+	started := false
+	return func(e trigger.Event) {
+		if !started && e.BuildNumber > 0 && (e.Status == trigger.EventRunning || e.Status == trigger.EventCompleted) {
+			started = true
+			postNotification(client, webhook, notification{
+				Job:         e.Job,
+				BuildNumber: e.BuildNumber,
+				Status:      "started",
+				Url:         e.Url,
+				Text:        fmt.Sprintf("Job %s build number %d started: %s", e.Job, e.BuildNumber, e.Url),
+			})
+		}
+		if e.Status != trigger.EventCompleted || forStart && e.Error == "" {
+			return
+		}
+		n := notification{Job: e.Job, BuildNumber: e.BuildNumber, Status: "finished", Url: e.Url, Result: e.Result.Result, Error: e.Error}
+		switch {
+		case e.Error != "":
+			n.Text = fmt.Sprintf("Job %s finished with error: %s", e.Job, e.Error)
+		default:
+			n.Text = fmt.Sprintf("Job %s build number %d finished: %s %s", e.Job, e.BuildNumber, e.Result.Result, e.Url)
+		}
+		postNotification(client, webhook, n)
+	}
+}
+
+// postNotification posts n to webhook with client, the failures are only logged, and the URL is left out of the logs since
+// the URLs of the webhooks are usually secrets
+func postNotification(client *http.Client, webhook string, n notification) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("failed to encode notification of job %s: %s", n.Job, err))
+		return
+	}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		logger.Warn(fmt.Sprintf("failed to notify that job %s is %s: %s", n.Job, n.Status, err))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		logger.Warn(fmt.Sprintf("failed to notify that job %s is %s: the webhook responds %s", n.Job, n.Status, resp.Status))
+	}
+}
+
+// printEvent prints the event as a JSON line to stdout
+func printEvent(e trigger.Event) {
+	if err := json.NewEncoder(os.Stdout).Encode(e); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print event: %s\n", err)
+	}
+}
+
+// load reads the YAML file at path into c, values of the flags which have been changed on the command line take precedence
+func (c *config) load(path string, flags *pflag.FlagSet) error {
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(home, path[2:])
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	changed := make(map[string]*pflag.Flag)
+	flags.Visit(func(f *pflag.Flag) {
+		changed[f.Name] = f
+	})
+	values := make(map[string][]string)
+	for name, f := range changed {
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			values[name] = s.GetSlice()
+		} else {
+			values[name] = []string{f.Value.String()}
+		}
+	}
+
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for name, f := range changed {
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			if err := s.Replace(values[name]); err != nil {
+				return err
+			}
+		} else if err := f.Value.Set(values[name][0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type wait struct {
+	trigger.Wait    `yaml:",inline"`
+	NoAbortOnSignal bool `yaml:"no-abort-on-signal"`
+	// LogFile is the path of the file to write the full console output of the build to while waiting
+	LogFile string `yaml:"log-file"`
+}
+
+type job struct {
+	Names           []string `yaml:"names"`
+	Paths           []string `yaml:"paths"`
+	FolderSeparator string   `yaml:"folder-separator"`
+	Branch          string   `yaml:"branch"`
+	Correlation     string   `yaml:"correlation-param"`
+	correlationKey  string
+	Params          map[string]string `yaml:"params"`
+	ValidateParams  bool              `yaml:"validate-params"`
+	Cause           string            `yaml:"cause"`
+	Files           map[string]string `yaml:"file-params"`
+	Choices         []string          `yaml:"-"`
+	// ParamsFromBuild is the number of the build to copy the parameters from
+	ParamsFromBuild  int64 `yaml:"params-from-build"`
+	IfNotBuilding    bool  `yaml:"if-not-building"`
+	EnableIfDisabled bool  `yaml:"enable-if-disabled"`
+	// ForceWithParameters triggers the job at /buildWithParameters even if it has no parameters
+	ForceWithParameters bool `yaml:"force-with-parameters"`
+	// BuildToken is the token of "Trigger builds remotely" of the jobs
+	BuildToken string `yaml:"build-token"`
+	// Folders are the folders of the jobs of Names, outermost first, each is split by FolderSeparator unless LiteralFolders is set
+	Folders        []string `yaml:"folders"`
+	LiteralFolders bool     `yaml:"literal-folders"`
+	// Fingerprint is a correlation parameter which verifies the build of the queue item instead of always scanning the recent builds
+	Fingerprint       string `yaml:"fingerprint"`
+	verifyCorrelation bool
+}
+
+// correlate adds the correlation parameter or the fingerprint to the params, a random value is generated if it's not given
+func (j *job) correlate() error {
+	spec := j.Correlation
+	if j.Fingerprint != "" {
+		if j.Correlation != "" {
+			return fmt.Errorf("--correlation-param and --fingerprint can not be used together")
+		}
+		spec, j.verifyCorrelation = j.Fingerprint, true
+	}
+	if spec == "" {
+		return nil
+	}
+	key, value := spec, ""
+	if strings.Contains(spec, "=") {
+		var err error
+		if key, value, err = splitKeyValue(spec); err != nil {
+			return err
+		}
+	} else {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		value = hex.EncodeToString(b)
+	}
+	if _, ok := j.Params[key]; ok {
+		return fmt.Errorf("correlation parameter %s is also given as a parameter", key)
+	}
+	j.Params[key] = value
+	j.correlationKey = key
+	return nil
+}
+
+type params struct {
+	slice   []string
+	csv     []string
+	json    string
+	yaml    string
+	file    []string
+	env     []string
+	bools   []string
+	choices []string
+	files   []string
+	strict  bool
+	// delimiter separates the keys and the values of --params and --params-csv
+	delimiter string
+	// fileFormat is the format of all the --params-file, detected by the extension of each if it's empty
+	fileFormat string
+	// expand expands the environment variables in the values, allowEmpty expands the undefined ones to empty
+	expand     bool
+	allowEmpty bool
+}
+
+// init merges the parameters from all sources onto base which is loaded from the config file,
+// the precedence is: --params, --params-csv, --bool-param, --choice-param > --param-from-env > --params-yaml > --params-json > --params-file > config file,
+// the later --params-file override the earlier ones.
+// In strict mode, a key given by more than one source is an error
+func (p *params) init(base map[string]string) (map[string]string, error) {
+	params := make(map[string]string)
+	sources := make(map[string]string)
+	merge := func(source string, m map[string]string) error {
+		for k, v := range m {
+			if prev, ok := sources[k]; ok && p.strict && prev != source {
+				return fmt.Errorf("parameter %s is given by both %s and %s", k, prev, source)
+			}
+			params[k] = v
+			sources[k] = source
+		}
+		return nil
+	}
+	if err := merge("config file", base); err != nil {
+		return nil, err
+	}
+	if len(p.file) > 0 {
+		// the later files override the earlier ones, e.g., the environment-specific overrides of a base file
+		m := make(map[string]string)
+		for _, file := range p.file {
+			if err := readParamsFile(file, p.fileFormat, m); err != nil {
+				return nil, err
+			}
+		}
+		if err := merge("--params-file", m); err != nil {
+			return nil, err
+		}
+	}
+	if p.json == "-" && p.yaml == "-" {
+		return nil, fmt.Errorf("--params-json and --params-yaml can not both be read from stdin")
+	}
+	if p.json != "" {
+		data, err := readValue("params json", p.json)
+		if err != nil {
+			return nil, err
+		}
+		m, err := parseParamsJson(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse params json: %w", err)
+		}
+		if err := merge("--params-json", m); err != nil {
+			return nil, err
+		}
+	}
+	if p.yaml != "" {
+		data, err := readValue("params yaml", p.yaml)
+		if err != nil {
+			return nil, err
+		}
+		m, err := parseParamsYaml(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse params yaml: %w", err)
+		}
+		if err := merge("--params-yaml", m); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range p.env {
+		key, value, err := lookupEnv(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := merge("--param-from-env", map[string]string{key: value}); err != nil {
+			return nil, err
+		}
+	}
+	if p.delimiter == "" {
+		return nil, fmt.Errorf("params delimiter can not be empty")
+	}
+	if p.delimiter == "," && len(p.csv) > 0 {
+		return nil, fmt.Errorf("params delimiter can not be a comma along with --params-csv, which separates the parameters with commas")
+	}
+	for _, v := range p.csv {
+		key, value, err := splitDelimited(v, p.delimiter)
+		if err != nil {
+			return nil, err
+		}
+		if err := merge("--params-csv", map[string]string{key: value}); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range p.slice {
+		key, value, err := splitDelimited(v, p.delimiter)
+		if err != nil {
+			return nil, err
+		}
+		if err := merge("--params", map[string]string{key: value}); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range p.bools {
+		key, value, err := splitBool(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := merge("--bool-param", map[string]string{key: value}); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range p.choices {
+		key, value, err := splitKeyValue(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := merge("--choice-param", map[string]string{key: value}); err != nil {
+			return nil, err
+		}
+	}
+	if p.expand {
+		if err := expandParams(params, p.allowEmpty); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+// expandParams replaces $VAR or ${VAR} in the values of params with the environment variables, $$ is a literal $.
+// The undefined variables are an error, unless allowEmpty is set, which replaces them with empty strings
+func expandParams(params map[string]string, allowEmpty bool) error {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var undefined []string
+		params[k] = os.Expand(params[k], func(name string) string {
+			if name == "$" {
+				return "$"
+			}
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				undefined = append(undefined, name)
+			}
+			return value
+		})
+		if len(undefined) > 0 && !allowEmpty {
+			return fmt.Errorf("environment variable %s in parameter %s is not set, use --expand-params-allow-empty to expand it to empty", strings.Join(undefined, ", "), k)
+		}
+	}
+	return nil
+}
+
+// choiceNames returns the names of the parameters given by --choice-param
+func (p *params) choiceNames() []string {
+	var names []string
+	for _, v := range p.choices {
+		if key, _, err := splitKeyValue(v); err == nil {
+			names = append(names, key)
+		}
+	}
+	return names
+}
+
+// splitBool splits v in key=value format, and normalizes the boolean value to true or false, which is what
+// Jenkins expects, since it parses anything other than true (ignoring case) as false, e.g., yes or 1
+func splitBool(v string) (string, string, error) {
+	key, value, err := splitKeyValue(v)
+	if err != nil {
+		return "", "", err
+	}
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return key, "true", nil
+	case "false", "no", "off", "0":
+		return key, "false", nil
+	}
+	return "", "", fmt.Errorf("invalid boolean parameter %q, the value must be one of: true, false, yes, no, on, off, 1, 0", v)
+}
+
+// initFiles merges the file parameters from --file-param onto base which is loaded from the config file,
+// and checks the files are readable
+func (p *params) initFiles(base map[string]string) (map[string]string, error) {
+	files := make(map[string]string)
+	for k, v := range base {
+		files[k] = v
+	}
+	for _, v := range p.files {
+		name, file, err := splitKeyValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file parameter %q, must be in name=path format", v)
+		}
+		files[name] = file
+	}
+	for name, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			return nil, fmt.Errorf("file %s of parameter %s: %w", file, name, err)
+		}
+	}
+	return files, nil
+}
+
+// readValue returns v, or the content of stdin if v is -
+func readValue(name, v string) ([]byte, error) {
+	if v != "-" {
+		return []byte(v), nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from stdin: %w", name, err)
+	}
+	return data, nil
+}
+
+// parseParamsJson parses the parameters from the JSON object in data, whose values must be strings, null is an empty string,
+// the error tells the key and the type of the first value in the order of the keys which is not
+func parseParamsJson(data []byte) (map[string]string, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return nil, fmt.Errorf("invalid JSON at offset %d: %w", syntaxErr.Offset, err)
+		case errors.As(err, &typeErr):
+			return nil, fmt.Errorf("must be a JSON object of the parameters, but got %s", typeErr.Value)
+		}
+		return nil, err
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make(map[string]string)
+	for _, k := range keys {
+		raw := values[k]
+		var v string
+		if err := json.Unmarshal(raw, &v); err == nil {
+			params[k] = v
+			continue
+		}
+		switch raw := strings.TrimSpace(string(raw)); {
+		case strings.HasPrefix(raw, "{"), strings.HasPrefix(raw, "["):
+			return nil, fmt.Errorf("parameter %s must be a string, but got %s, nested structures are not supported", k, jsonType(raw))
+		default:
+			return nil, fmt.Errorf("parameter %s must be a string, but got %s %s, quote it as \"%[3]s\"", k, jsonType(raw), raw)
+		}
+	}
+	return params, nil
+}
+
+// jsonType returns the type of the JSON value raw, one of: object, array, boolean, number
+func jsonType(raw string) string {
+	switch {
+	case strings.HasPrefix(raw, "{"):
+		return "object"
+	case strings.HasPrefix(raw, "["):
+		return "array"
+	case raw == "true" || raw == "false":
+		return "boolean"
+	default:
+		return "number"
+	}
+}
+
+// parseParamsYaml parses the parameters from the YAML object in data, the scalar values are taken as they are written,
+// e.g., 1.10 stays 1.10, null is an empty string, and the nested structures are rejected
+func parseParamsYaml(data []byte) (map[string]string, error) {
+	nodes := make(map[string]yaml.Node)
+	if err := yaml.Unmarshal(data, &nodes); err != nil {
+		return nil, err
+	}
+	params := make(map[string]string)
+	for k, node := range nodes {
+		switch {
+		case node.Kind == yaml.ScalarNode && node.Tag == "!!null":
+			params[k] = ""
+		case node.Kind == yaml.ScalarNode:
+			params[k] = node.Value
+		default:
+			return nil, fmt.Errorf("parameter %s at line %d must be a scalar value, nested structures are not supported", k, node.Line)
+		}
+	}
+	return params, nil
+}
+
+// readParamsFile reads the parameters from path into params in format, one of: json, yaml, properties,
+// or detected by the extension if it's empty: a file with .json extension is parsed as a JSON object,
+// .yaml or .yml as a YAML object, otherwise it's parsed as key=value pairs, one per line,
+// empty lines and lines starting with # are skipped
+func readParamsFile(path, format string, params map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read params file %s: %w", path, err)
+	}
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			format = paramsFormatJson
+		case ".yaml", ".yml":
+			format = paramsFormatYaml
+		default:
+			format = paramsFormatProperties
+		}
+	}
+	switch format {
+	case paramsFormatJson:
+		m, err := parseParamsJson(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse params file %s: %w", path, err)
+		}
+		for k, v := range m {
+			params[k] = v
+		}
+		return nil
+	case paramsFormatYaml:
+		m, err := parseParamsYaml(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse params file %s: %w", path, err)
+		}
+		for k, v := range m {
+			params[k] = v
+		}
+		return nil
+	case paramsFormatProperties:
+	default:
+		return fmt.Errorf("invalid params file format %q, must be one of: %s, %s, %s", format, paramsFormatJson, paramsFormatYaml, paramsFormatProperties)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, err := splitKeyValue(line)
+		if err != nil {
+			return fmt.Errorf("failed to parse params file %s: %w", path, err)
+		}
+		params[key] = value
+	}
+	return nil
+}
+
+// splitKeyValue splits v in key=value format, the value may contain '='
+func splitKeyValue(v string) (string, string, error) {
+	return splitDelimited(v, defaultParamsDelimiter)
+}
+
+// splitDelimited splits v into the key and the value at the first delimiter
+func splitDelimited(v, delimiter string) (string, string, error) {
+	split := strings.SplitN(v, delimiter, 2)
+	if len(split) != 2 || split[0] == "" {
+		return "", "", fmt.Errorf("invalid parameter %q, must be in key%svalue format", v, delimiter)
+	}
+	return split[0], split[1], nil
+}
+
+// lookupEnv reads the parameter from the environment variable described by v in ENV[=name][:-default] format
+func lookupEnv(v string) (string, string, error) {
+	spec, def, hasDefault := v, "", false
+	if i := strings.Index(v, ":-"); i >= 0 {
+		spec, def, hasDefault = v[:i], v[i+2:], true
+	}
+	env, key := spec, spec
+	if i := strings.Index(spec, "="); i >= 0 {
+		env, key = spec[:i], spec[i+1:]
+	}
+	if env == "" || key == "" {
+		return "", "", fmt.Errorf("invalid parameter from env %q, must be in ENV[=name][:-default] format", v)
+	}
+	value, ok := os.LookupEnv(env)
+	if !ok {
+		if !hasDefault {
+			return "", "", fmt.Errorf("environment variable %s of parameter %s is not set", env, key)
+		}
+		value = def
+	}
+	return key, value, nil
 }
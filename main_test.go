@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/shihyuho/go-jenkins-trigger/pkg/trigger"
+	"github.com/spf13/pflag"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseParams parses args with the flags of the parameters, and merges the parameters of them
+func parseParams(t *testing.T, args ...string) (map[string]string, error) {
+	t.Helper()
+	p := params{delimiter: defaultParamsDelimiter}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	paramsFlags(flags, &p)
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("failed to parse %v: %s", args, err)
+	}
+	return p.init(nil)
+}
+
+func TestParamsWithCommasAndEquals(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{name: "comma in value", args: []string{"-p", "msg=hello, world"}, want: map[string]string{"msg": "hello, world"}},
+		{name: "equals sign in value", args: []string{"-p", "q=a=b"}, want: map[string]string{"q": "a=b"}},
+		{name: "multiple", args: []string{"-p", "msg=hello, world", "--params", "q=a=b"}, want: map[string]string{"msg": "hello, world", "q": "a=b"}},
+		{name: "csv", args: []string{"--params-csv", "foo=bar,baz=qux"}, want: map[string]string{"foo": "bar", "baz": "qux"}},
+		{name: "quoted csv", args: []string{"--params-csv", `foo=bar,"msg=hello, world"`}, want: map[string]string{"foo": "bar", "msg": "hello, world"}},
+		{name: "quoted csv with equals sign", args: []string{"--params-csv", `"q=a=b,c",x=y`}, want: map[string]string{"q": "a=b,c", "x": "y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseParams(t, tt.args...)
+			if err != nil {
+				t.Fatalf("init() error = %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("init() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmptyParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		force    bool
+		want     map[string]string
+		endpoint string
+	}{
+		{name: "empty value", args: []string{"-p", "k="}, want: map[string]string{"k": ""}, endpoint: "/job/myjob/buildWithParameters"},
+		{name: "empty value with delimiter", args: []string{"--params-delimiter", ":", "-p", "k:"}, want: map[string]string{"k": ""}, endpoint: "/job/myjob/buildWithParameters"},
+		{name: "empty json object", args: []string{"--params-json", "{}"}, want: map[string]string{}, endpoint: "/job/myjob/build"},
+		{name: "empty yaml object", args: []string{"--params-yaml", "{}"}, want: map[string]string{}, endpoint: "/job/myjob/build"},
+		{name: "none", want: map[string]string{}, endpoint: "/job/myjob/build"},
+		{name: "none with force", force: true, want: map[string]string{}, endpoint: "/job/myjob/buildWithParameters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseParams(t, tt.args...)
+			if err != nil {
+				t.Fatalf("init() error = %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("init() = %v, want %v", got, tt.want)
+			}
+
+			var endpoint string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					// the job is not parameterized
+					fmt.Fprint(w, `{"color":"blue"}`)
+					return
+				}
+				endpoint = r.URL.Path
+				w.Header().Set("Location", "/queue/item/1/")
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer server.Close()
+			j := trigger.Jenkins{Url: server.URL, NoCrumb: true}
+			jenkins, err := j.CreateClient(context.Background())
+			if err != nil {
+				t.Fatalf("CreateClient() error = %s", err)
+			}
+			if _, err := trigger.Start(context.Background(), jenkins, trigger.Config{Job: trigger.Job{Name: "myjob", Params: got, ForceWithParameters: tt.force}}); err != nil {
+				t.Fatalf("Start() error = %s", err)
+			}
+			if endpoint != tt.endpoint {
+				t.Errorf("triggered at %s, want %s", endpoint, tt.endpoint)
+			}
+		})
+	}
+}
+
+func TestJobFolders(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		folders  []string
+		fullName string
+		path     string
+	}{
+		{name: "split", args: []string{"-f", "a/b", "-j", "myjob"}, folders: []string{"a", "b"}, fullName: "a/b/myjob", path: "/job/a/job/b/job/myjob"},
+		{name: "literal", args: []string{"-f", "a/b", "-j", "myjob", "--literal-folders"}, folders: []string{"a/b"}, fullName: "a/b/myjob", path: "/job/a%2Fb/job/myjob"},
+		{name: "nested", args: []string{"-f", "a/b", "-f", "c", "-j", "myjob"}, folders: []string{"a", "b", "c"}, fullName: "a/b/c/myjob", path: "/job/a/job/b/job/c/job/myjob"},
+		{name: "nested literal", args: []string{"-f", "a/b", "-f", "c", "-j", "myjob", "--literal-folders"}, folders: []string{"a/b", "c"}, fullName: "a/b/c/myjob", path: "/job/a%2Fb/job/c/job/myjob"},
+		{name: "not split by commas", args: []string{"-f", "a,b", "-j", "myjob"}, folders: []string{"a,b"}, fullName: "a,b/myjob", path: "/job/a%2Cb/job/myjob"},
+		{name: "separator", args: []string{"-f", `a\b`, "-j", "myjob", "--folder-separator", `\`}, folders: []string{"a", "b"}, fullName: "a/b/myjob", path: "/job/a/job/b/job/myjob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config{Job: job{FolderSeparator: defaultFolderSeparator}}
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			jobFlags(flags, &c)
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("failed to parse %v: %s", tt.args, err)
+			}
+			if got := c.folders(); !reflect.DeepEqual(got, tt.folders) {
+				t.Errorf("folders() = %q, want %q", got, tt.folders)
+			}
+			jobs, err := c.jobs()
+			if err != nil {
+				t.Fatalf("jobs() error = %s", err)
+			}
+			if len(jobs) != 1 {
+				t.Fatalf("jobs() = %d jobs, want 1", len(jobs))
+			}
+			if !reflect.DeepEqual(jobs[0].Folders, tt.folders) {
+				t.Errorf("jobs() folders = %q, want %q", jobs[0].Folders, tt.folders)
+			}
+			if got := jobs[0].FullName(); got != tt.fullName {
+				t.Errorf("FullName() = %s, want %s", got, tt.fullName)
+			}
+			if got := jobs[0].Path(); got != tt.path {
+				t.Errorf("Path() = %s, want %s", got, tt.path)
+			}
+		})
+	}
+}
+
+func TestParamFromEnv(t *testing.T) {
+	t.Setenv("GIT_COMMIT", "abc")
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{name: "same name", args: []string{"--param-from-env", "GIT_COMMIT"}, want: map[string]string{"GIT_COMMIT": "abc"}},
+		{name: "renamed", args: []string{"--param-from-env", "GIT_COMMIT=commit"}, want: map[string]string{"commit": "abc"}},
+		{name: "default with comma", args: []string{"--param-from-env", "JT_TEST_UNSET:-a,b"}, want: map[string]string{"JT_TEST_UNSET": "a,b"}},
+		{name: "multiple", args: []string{"--param-from-env", "GIT_COMMIT=commit", "--param-from-env", "JT_TEST_UNSET=list:-a,b"}, want: map[string]string{"commit": "abc", "list": "a,b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseParams(t, tt.args...)
+			if err != nil {
+				t.Fatalf("init() error = %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("init() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrictParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    map[string]string
+		wantErr string
+	}{
+		{name: "csv and params", args: []string{"--strict-params", "--params-csv", "a=1", "-p", "a=2"}, wantErr: "parameter a is given by both --params-csv and --params"},
+		{name: "json and params", args: []string{"--strict-params", "--params-json", `{"a":"1"}`, "-p", "a=2"}, wantErr: "parameter a is given by both --params-json and --params"},
+		{name: "params twice", args: []string{"--strict-params", "-p", "a=1", "-p", "a=2"}, want: map[string]string{"a": "2"}},
+		{name: "csv overridden by params", args: []string{"--params-csv", "a=1", "-p", "a=2"}, want: map[string]string{"a": "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseParams(t, tt.args...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("init() = %v, %v, want error %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("init() error = %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("init() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
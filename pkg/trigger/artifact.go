@@ -0,0 +1,111 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"github.com/bndr/gojenkins"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Artifacts is the configuration of downloading the artifacts of the build once it's completed successfully
+type Artifacts struct {
+	// Pattern is the glob matched against the relative path or the file name of the artifacts, empty means no downloading
+	Pattern string `yaml:"pattern"`
+	// Dir is the directory to save the artifacts to, the relative paths of the artifacts are kept
+	Dir string `yaml:"dir"`
+}
+
+// downloadArtifacts saves the artifacts of the build which match the pattern, and records the saved files in r
+func downloadArtifacts(ctx context.Context, c Config, jenkins *gojenkins.Jenkins, r *Result) error {
+	build, err := c.Job.getBuild(ctx, jenkins, r.BuildNumber)
+	if err != nil {
+		return fmt.Errorf("failed to get artifacts of job %s, build number %d: %w", r.Job, r.BuildNumber, err)
+	}
+	for _, artifact := range build.Raw.Artifacts {
+		matched, err := c.Artifacts.match(artifact.RelativePath, artifact.FileName)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		file, err := c.Artifacts.save(ctx, build, artifact.RelativePath)
+		if err != nil {
+			return fmt.Errorf("failed to download artifact %s of job %s, build number %d: %w", artifact.RelativePath, r.Job, r.BuildNumber, err)
+		}
+		r.Artifacts = append(r.Artifacts, file)
+		c.Logger.Info(fmt.Sprintf("Job %s, build number %d, artifact %s saved to %s", r.Job, r.BuildNumber, artifact.RelativePath, file))
+	}
+	if len(r.Artifacts) == 0 {
+		c.Logger.Warn(fmt.Sprintf("no artifact of job %s, build number %d matches %s", r.Job, r.BuildNumber, c.Artifacts.Pattern))
+	}
+	return nil
+}
+
+func (a *Artifacts) match(relativePath, fileName string) (bool, error) {
+	matched, err := path.Match(a.Pattern, relativePath)
+	if err == nil && !matched {
+		matched, err = path.Match(a.Pattern, fileName)
+	}
+	if err != nil {
+		return false, fmt.Errorf("invalid artifact pattern %q: %w", a.Pattern, err)
+	}
+	return matched, nil
+}
+
+// save downloads the artifact of relativePath into the directory, and returns the path of the saved file
+func (a *Artifacts) save(ctx context.Context, build *gojenkins.Build, relativePath string) (string, error) {
+	file := filepath.Join(a.Dir, filepath.FromSlash(relativePath))
+	if rel, err := filepath.Rel(a.Dir, file); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("artifact path is outside of %s", a.Dir)
+	}
+	segments := strings.Split(relativePath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	requester := build.Jenkins.Requester
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requester.Base+build.Base+"/artifact/"+strings.Join(segments, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	if requester.BasicAuth != nil {
+		req.SetBasicAuth(requester.BasicAuth.Username, requester.BasicAuth.Password)
+	}
+	// the artifact may be large, so it's streamed to the file without the time limit of each request
+	client := *requester.Client
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", err
+	}
+	// written to a temp file which is renamed once completed, so no partial artifact is left behind
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", err
+	}
+	return file, os.Rename(tmp.Name(), file)
+}
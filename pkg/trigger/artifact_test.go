@@ -0,0 +1,77 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"github.com/bndr/gojenkins"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArtifactsSave(t *testing.T) {
+	jenkins := newJenkins(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/job/myjob/5/artifact/out/app.bin":
+			fmt.Fprint(w, "part1,")
+			w.(http.Flusher).Flush()
+			// slower than the request timeout, which must not cut the download
+			time.Sleep(200 * time.Millisecond)
+			fmt.Fprint(w, "part2")
+		case "/job/myjob/5/artifact/..app.txt":
+			fmt.Fprint(w, "app")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	jenkins.Requester.Client.Timeout = 100 * time.Millisecond
+	build := &gojenkins.Build{Jenkins: jenkins, Base: "/job/myjob/5"}
+	dir := t.TempDir()
+	a := &Artifacts{Pattern: "*", Dir: dir}
+
+	tests := []struct {
+		relativePath string
+		want         string
+		wantErr      string
+	}{
+		{relativePath: "out/app.bin", want: "part1,part2"},
+		{relativePath: "..app.txt", want: "app"},
+		{relativePath: "../app.txt", wantErr: "artifact path is outside of"},
+		{relativePath: "missing.txt", wantErr: "404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.relativePath, func(t *testing.T) {
+			file, err := a.save(context.Background(), build, tt.relativePath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("save() = %s, %v, want error %q", file, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("save() error = %s", err)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("failed to read %s: %s", file, err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("save() wrote %q, want %q", data, tt.want)
+			}
+		})
+	}
+	// no temp file is left behind, neither of the completed nor the failed downloads
+	var files []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if len(files) != 2 {
+		t.Errorf("files = %s, want only the 2 artifacts", strings.Join(files, ", "))
+	}
+}
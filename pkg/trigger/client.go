@@ -0,0 +1,502 @@
+package trigger
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/avast/retry-go"
+	"github.com/bndr/gojenkins"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	crumbIssuerPath  = "/crumbIssuer"
+	defaultUserAgent = "go-jenkins-trigger"
+)
+
+type Jenkins struct {
+	Url  string `yaml:"url"`
+	User string `yaml:"user"`
+	Pat  string `yaml:"pat"`
+	// PatFile is the path of the file to read the PAT from, it can not be set along with Pat
+	PatFile  string `yaml:"pat-file"`
+	Insecure bool   `yaml:"insecure"`
+	NoCrumb  bool   `yaml:"no-crumb"`
+	// NoInit skips verifying the connection when the client is created, the errors of connecting surface on the first request instead
+	NoInit     bool   `yaml:"no-init"`
+	CaCert     string `yaml:"ca-cert"`
+	ClientCert string `yaml:"client-cert"`
+	ClientKey  string `yaml:"client-key"`
+	// TlsServerName is the hostname to verify the certificate of the server against, instead of the one in Url
+	TlsServerName string `yaml:"tls-server-name"`
+	// Host is the Host header of the requests instead of the host in Url, e.g., the actual host of Jenkins reached through
+	// a forwarded port, the certificate of the server is verified against its hostname too unless TlsServerName is set
+	Host string `yaml:"host"`
+	// Proxy is the URL of the proxy server, the proxy environment variables are used if it's empty
+	Proxy string `yaml:"proxy"`
+	// RequestTimeout is the time limit of each HTTP request, 0 means no limit
+	RequestTimeout time.Duration `yaml:"request-timeout"`
+	// UserAgent is the User-Agent header of the requests, go-jenkins-trigger if it's empty
+	UserAgent string `yaml:"user-agent"`
+	// Cookies are sent along with the requests in name=value format, e.g., the session cookie issued by an SSO proxy
+	Cookies []string `yaml:"cookies"`
+	// CookieFile is the path of the file to read more cookies from, name=value pairs one per line, or in Netscape cookies.txt format
+	CookieFile string `yaml:"cookie-file"`
+	// Headers are sent along with all the requests in "Name: value" format, e.g., the API key required by an API gateway
+	Headers []string `yaml:"headers"`
+	// HeadersFromEnv are the headers read from the environment variables in ENV=Name format, to keep the secrets off the command line
+	HeadersFromEnv []string `yaml:"headers-from-env"`
+	// ConnectRetries is how many times to retry verifying the connection on the transient errors, e.g., Jenkins is restarting
+	ConnectRetries uint `yaml:"connect-retries"`
+	// ConnectRetryDelay is how long to wait between verifying the connection, unless Jenkins asks for longer by Retry-After
+	ConnectRetryDelay time.Duration `yaml:"connect-retry-delay"`
+	// Logger logs the metadata of the requests and responses at debug level, and the redirects to another server
+	// at warn level, nil discards the logs
+	Logger *Logger `yaml:"-"`
+}
+
+// CreateClient creates the client of the Jenkins server, and verifies the connection unless NoInit is set.
+// The error matches ErrAuth with errors.Is if Jenkins rejects the credentials
+func (j *Jenkins) CreateClient(ctx context.Context) (*gojenkins.Jenkins, error) {
+	base, err := NormalizeUrl(j.Url)
+	if err != nil {
+		return nil, err
+	}
+	j.Url = base
+	if strings.Contains(j.Host, "/") {
+		return nil, fmt.Errorf("invalid Jenkins host %s, must be a host with an optional port, e.g., myjenkins.com:8443", j.Host)
+	}
+	jar, err := j.cookieJar()
+	if err != nil {
+		return nil, err
+	}
+	httpTransport, err := j.Transport()
+	if err != nil {
+		return nil, err
+	}
+	userAgent := j.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	header, err := j.header()
+	if err != nil {
+		return nil, err
+	}
+	header.Set("User-Agent", userAgent)
+	u, err := url.Parse(j.Url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Jenkins URL %s: %w", j.Url, err)
+	}
+	transport := &crumbTransport{
+		RoundTripper: &logTransport{
+			RoundTripper: &headerTransport{
+				RoundTripper: httpTransport,
+				header:       header,
+				host:         j.Host,
+			},
+			logger: j.Logger,
+		},
+		// the crumb issuer is under the subpath of Jenkins, e.g., /jenkins/crumbIssuer if it's reverse-proxied at /jenkins/
+		issuer:  strings.TrimSuffix(u.Path, "/") + crumbIssuerPath,
+		fetched: j.NoCrumb,
+	}
+	client := &http.Client{Transport: transport, Jar: jar, Timeout: j.RequestTimeout, CheckRedirect: j.checkRedirect}
+	pat, err := j.pat()
+	if err != nil {
+		return nil, err
+	}
+	var auth []interface{}
+	if j.User != "" || pat != "" {
+		auth = []interface{}{j.User, pat}
+	}
+	// without the credentials, no Authorization header is sent, e.g., authenticated by the cookies instead
+	jenkins := gojenkins.CreateJenkins(client, j.Url, auth...)
+	if j.NoInit {
+		initLoggers()
+	} else if err := j.init(ctx, jenkins); err != nil {
+		return nil, err
+	}
+	if !transport.fetched {
+		if err := transport.fetch(ctx, jenkins); err != nil {
+			return nil, err
+		}
+	}
+	return jenkins, nil
+}
+
+// init verifies the connection to Jenkins, which is retried up to ConnectRetries times on the transient errors,
+// i.e., the connection is refused, or Jenkins responds 502/503/504, e.g., while it's restarting
+func (j *Jenkins) init(ctx context.Context, jenkins *gojenkins.Jenkins) error {
+	return retry.Do(
+		func() error {
+			_, err := jenkins.Init(ctx)
+			if err == nil {
+				return nil
+			}
+			// gojenkins does not tell the status, request again to report it, e.g., as ErrAuth if it's 401
+			resp, e := jenkins.Requester.GetJSON(ctx, "/", &struct{}{}, nil)
+			switch {
+			case e != nil:
+				// unlike the one of Init, it tells whether the connection is refused
+				return e
+			case resp.StatusCode != http.StatusOK:
+				return fmt.Errorf("failed to connect to Jenkins %s: %w", j.Url, newHttpError(resp))
+			}
+			// Jenkins has become available in between, e.g., it has just finished restarting
+			_, err = jenkins.Init(ctx)
+			return err
+		},
+		retry.Attempts(j.ConnectRetries+1),
+		retry.DelayType(func(n uint, err error, _ *retry.Config) time.Duration {
+			var httpErr *httpError
+			if errors.As(err, &httpErr) && httpErr.retryAfter > j.ConnectRetryDelay {
+				return httpErr.retryAfter
+			}
+			return j.ConnectRetryDelay
+		}),
+		retry.LastErrorOnly(true),
+		retry.Context(ctx),
+		retry.RetryIf(transient),
+		retry.OnRetry(func(n uint, err error) {
+			// it's called after the last attempt as well
+			if n < j.ConnectRetries {
+				j.Logger.Warn(fmt.Sprintf("%s, retrying (%d/%d)", err, n+1, j.ConnectRetries))
+			}
+		}),
+	)
+}
+
+// initLoggers sets up the loggers of gojenkins as Init does, which panics on logging without them,
+// except that they write to stderr to keep stdout for the results
+func initLoggers() {
+	flags := log.Ldate | log.Ltime | log.Lshortfile
+	if gojenkins.Info == nil {
+		gojenkins.Info = log.New(os.Stderr, "INFO: ", flags)
+	}
+	if gojenkins.Warning == nil {
+		gojenkins.Warning = log.New(os.Stderr, "WARNING: ", flags)
+	}
+	if gojenkins.Error == nil {
+		gojenkins.Error = log.New(os.Stderr, "ERROR: ", flags)
+	}
+}
+
+// NormalizeUrl returns the URL of the Jenkins server without the trailing slashes, so that the paths of the requests
+// are not doubled up, e.g., http://jenkins:8080/ is http://jenkins:8080, an error is returned if the scheme is
+// missing or not one of http and https, or the host is missing
+func NormalizeUrl(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("Jenkins URL can not be empty")
+	}
+	if !strings.Contains(raw, "://") {
+		// e.g., jenkins:8080 is parsed with scheme jenkins
+		return "", fmt.Errorf("invalid Jenkins URL %s, the scheme is missing, e.g., http://%s", raw, raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid Jenkins URL %s: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid Jenkins URL %s, the scheme must be one of: http, https", raw)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid Jenkins URL %s, the host is missing", raw)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// checkRedirect warns about the redirects to another server, e.g., from http to https, since the POST requests to trigger
+// the jobs are turned into GET ones by the redirects, which Jenkins rejects
+func (j *Jenkins) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if prev := via[len(via)-1]; prev.URL.Scheme != req.URL.Scheme || prev.URL.Host != req.URL.Host {
+		j.Logger.Warn(fmt.Sprintf("Jenkins URL %s is redirected to %s://%s, use it as the Jenkins URL instead", j.Url, req.URL.Scheme, req.URL.Host))
+	}
+	return nil
+}
+
+// pat returns the PAT, which is read from PatFile if it's set
+func (j *Jenkins) pat() (string, error) {
+	if j.PatFile == "" {
+		return j.Pat, nil
+	}
+	if j.Pat != "" {
+		return "", fmt.Errorf("PAT and PAT file can not be specified together")
+	}
+	data, err := os.ReadFile(j.PatFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read PAT file %s: %w", j.PatFile, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// cookieJar returns the cookie jar of the client, which contains Cookies and the cookies in CookieFile
+func (j *Jenkins) cookieJar() (http.CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	lines := j.Cookies
+	if j.CookieFile != "" {
+		data, err := os.ReadFile(j.CookieFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cookie file %s: %w", j.CookieFile, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(strings.TrimPrefix(line, "#HttpOnly_"))
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if fields := strings.Split(line, "\t"); len(fields) == 7 {
+				// domain, include subdomains, path, secure, expiry, name and value of Netscape cookies.txt format
+				line = fields[5] + "=" + fields[6]
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return jar, nil
+	}
+	u, err := url.Parse(j.Url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Jenkins URL %s: %w", j.Url, err)
+	}
+	var cookies []*http.Cookie
+	for _, line := range lines {
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid cookie %q, must be in name=value format", line)
+		}
+		cookies = append(cookies, &http.Cookie{Name: strings.TrimSpace(line[:i]), Value: strings.TrimSpace(line[i+1:]), Path: "/"})
+	}
+	jar.SetCookies(u, cookies)
+	return jar, nil
+}
+
+// proxy returns the proxy of the requests, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are honored unless Proxy is set
+func (j *Jenkins) proxy() (func(*http.Request) (*url.URL, error), error) {
+	if j.Proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(j.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %s: %w", j.Proxy, err)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// Transport returns the transport of the requests to Jenkins, which goes through Proxy and is secured by the TLS config
+// of Insecure, CaCert, the client certificate and TlsServerName, e.g., for the requests to the other servers alike
+func (j *Jenkins) Transport() (*http.Transport, error) {
+	tlsConfig, err := j.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := j.proxy()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Transport{Proxy: proxy, TLSClientConfig: tlsConfig}, nil
+}
+
+func (j *Jenkins) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: j.Insecure, ServerName: j.TlsServerName}
+	if config.ServerName == "" && j.Host != "" {
+		// the host of the forwarded port, e.g., localhost, is not the one in the certificate
+		config.ServerName = (&url.URL{Host: j.Host}).Hostname()
+	}
+	if (j.ClientCert == "") != (j.ClientKey == "") {
+		return nil, fmt.Errorf("client certificate and client key must be specified together")
+	}
+	if j.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(j.ClientCert, j.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate %s and key %s: %w", j.ClientCert, j.ClientKey, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if !j.Insecure && j.CaCert != "" {
+		pem, err := os.ReadFile(j.CaCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate %s: %w", j.CaCert, err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in CA certificate %s", j.CaCert)
+		}
+	}
+	return config, nil
+}
+
+// header returns the headers of Headers and HeadersFromEnv, the ones of the same name are all sent
+func (j *Jenkins) header() (http.Header, error) {
+	header := http.Header{}
+	for _, h := range j.Headers {
+		i := strings.Index(h, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header %q, must be in \"Name: value\" format", h)
+		}
+		name, value := strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:])
+		if err := j.addHeader(header, name, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, h := range j.HeadersFromEnv {
+		i := strings.Index(h, "=")
+		if i <= 0 || i == len(h)-1 {
+			return nil, fmt.Errorf("invalid header from env %q, must be in ENV=Name format", h)
+		}
+		env, name := h[:i], h[i+1:]
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s of header %s is not set", env, name)
+		}
+		if err := j.addHeader(header, name, value); err != nil {
+			return nil, err
+		}
+	}
+	return header, nil
+}
+
+// addHeader adds the header name: value, the headers which are set by the other options are rejected
+func (j *Jenkins) addHeader(header http.Header, name, value string) error {
+	switch http.CanonicalHeaderKey(name) {
+	case "":
+		return fmt.Errorf("header name can not be empty")
+	case "Host":
+		return fmt.Errorf("header %s can not be set, use --jenkins-host instead", name)
+	case "User-Agent":
+		return fmt.Errorf("header %s can not be set, use --user-agent instead", name)
+	}
+	header.Add(name, value)
+	return nil
+}
+
+// crumbTransport attaches the CSRF crumb to the POST requests
+type crumbTransport struct {
+	http.RoundTripper
+	issuer  string
+	field   string
+	crumb   string
+	fetched bool
+}
+
+// fetch gets the crumb from the crumb issuer of Jenkins, a 404 response means CSRF protection is disabled
+func (t *crumbTransport) fetch(ctx context.Context, jenkins *gojenkins.Jenkins) error {
+	crumb := struct {
+		Field string `json:"crumbRequestField"`
+		Crumb string `json:"crumb"`
+	}{}
+	resp, err := jenkins.Requester.GetJSON(ctx, crumbIssuerPath, &crumb, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get CSRF crumb: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		t.field, t.crumb = crumb.Field, crumb.Crumb
+	case http.StatusNotFound:
+	default:
+		return fmt.Errorf("failed to get CSRF crumb from %s%s: %s, check the permissions of the user, or use --no-crumb to skip", jenkins.Server, crumbIssuerPath, resp.Status)
+	}
+	t.fetched = true
+	return nil
+}
+
+func (t *crumbTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.fetched && strings.HasPrefix(req.URL.Path, t.issuer+"/") {
+		// gojenkins requests a crumb before every POST and ignores the failures, reply it with 404 to leave the crumb to us
+		return &http.Response{
+			Status:     "404 Not Found",
+			StatusCode: http.StatusNotFound,
+			Proto:      req.Proto,
+			ProtoMajor: req.ProtoMajor,
+			ProtoMinor: req.ProtoMinor,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("{}")),
+			Request:    req,
+		}, nil
+	}
+	if t.field != "" && req.Method == http.MethodPost {
+		req = req.Clone(req.Context())
+		req.Header.Set(t.field, t.crumb)
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// headerTransport sets the headers of all the requests, and the Host header if host is set
+type headerTransport struct {
+	http.RoundTripper
+	header http.Header
+	host   string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+	if t.host != "" {
+		// the Host header in req.Header is ignored, it's sent from req.Host
+		req.Host = t.host
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// logTransport logs the metadata of the requests and responses at debug level, the credentials are redacted
+type logTransport struct {
+	http.RoundTripper
+	logger *Logger
+}
+
+func (t *logTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.logger.Enabled(LevelDebug) {
+		return t.RoundTripper.RoundTrip(req)
+	}
+	start := time.Now()
+	u := redactUrl(req.URL)
+	t.logger.Debug(fmt.Sprintf("HTTP request %s %s", req.Method, u), "header", redact(req.Header))
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		t.logger.Debug(fmt.Sprintf("HTTP request %s %s failed after %s: %s", req.Method, u, time.Since(start).Round(time.Millisecond), err))
+		return nil, err
+	}
+	t.logger.Debug(fmt.Sprintf("HTTP response %s %s: %s in %s", req.Method, u, resp.Status, time.Since(start).Round(time.Millisecond)), "header", redact(resp.Header), "contentLength", resp.ContentLength)
+	return resp, nil
+}
+
+// redactUrl returns u with the password and the build token redacted
+func redactUrl(u *url.URL) string {
+	q := u.Query()
+	if _, ok := q["token"]; !ok {
+		return u.Redacted()
+	}
+	q.Set("token", "REDACTED")
+	copied := *u
+	copied.RawQuery = q.Encode()
+	return copied.Redacted()
+}
+
+// redact returns a copy of header with the values of the credentials replaced
+func redact(header http.Header) http.Header {
+	header = header.Clone()
+	for _, k := range []string{"Authorization", "Cookie", "Set-Cookie", "Jenkins-Crumb"} {
+		if _, ok := header[k]; ok {
+			header[k] = []string{"REDACTED"}
+		}
+	}
+	return header
+}
@@ -0,0 +1,108 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateClientWithSubpath(t *testing.T) {
+	for _, subpath := range []string{"/jenkins", "/jenkins/"} {
+		t.Run(subpath, func(t *testing.T) {
+			reqs := &requests{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reqs.add(r)
+				switch {
+				case r.URL.Path == "/jenkins/api/json":
+					fmt.Fprint(w, `{}`)
+				case r.URL.Path == "/jenkins/crumbIssuer/api/json":
+					fmt.Fprint(w, `{"crumbRequestField":"Jenkins-Crumb","crumb":"c0ffee"}`)
+				case r.Method == http.MethodGet && r.URL.Path == "/jenkins/job/myjob/api/json":
+					fmt.Fprint(w, `{"color":"blue"}`)
+				case r.Method == http.MethodPost && r.URL.Path == "/jenkins/job/myjob/build":
+					if r.Header.Get("Jenkins-Crumb") != "c0ffee" {
+						http.Error(w, "No valid crumb was included in the request", http.StatusForbidden)
+						return
+					}
+					w.Header().Set("Location", "/jenkins/queue/item/9/")
+					w.WriteHeader(http.StatusCreated)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			j := &Jenkins{Url: server.URL + subpath}
+			jenkins, err := j.CreateClient(context.Background())
+			if err != nil {
+				t.Fatalf("CreateClient() error = %s", err)
+			}
+			for i := 0; i < 2; i++ {
+				queueId, err := buildJob(context.Background(), jenkins, Job{Name: "myjob"})
+				if err != nil {
+					t.Fatalf("buildJob() error = %s", err)
+				}
+				if queueId != 9 {
+					t.Errorf("buildJob() = %d, want 9", queueId)
+				}
+			}
+			// the crumb is fetched once and reused, instead of by gojenkins before every POST
+			crumbs := 0
+			for _, u := range reqs.uris {
+				if strings.HasPrefix(u, "GET /jenkins/crumbIssuer/") {
+					crumbs++
+				}
+			}
+			if crumbs != 1 {
+				t.Errorf("requests = %s, want the crumb from /jenkins/crumbIssuer once", strings.Join(reqs.uris, ", "))
+			}
+			if got, want := queueUrl(jenkins, 9), server.URL+"/jenkins/queue/item/9/"; got != want {
+				t.Errorf("queueUrl() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestNormalizeUrl(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{raw: "http://jenkins:8080", want: "http://jenkins:8080"},
+		{raw: "http://jenkins:8080/", want: "http://jenkins:8080"},
+		{raw: "https://ci.example.com/jenkins//", want: "https://ci.example.com/jenkins"},
+		{raw: "  http://jenkins:8080/\n", want: "http://jenkins:8080"},
+		{raw: "", wantErr: "Jenkins URL can not be empty"},
+		{raw: "   ", wantErr: "Jenkins URL can not be empty"},
+		{raw: "jenkins:8080", wantErr: "the scheme is missing"},
+		{raw: "jenkins.example.com/jenkins", wantErr: "the scheme is missing"},
+		{raw: "://", wantErr: "invalid Jenkins URL ://"},
+		{raw: "://jenkins:8080", wantErr: "invalid Jenkins URL ://jenkins:8080"},
+		{raw: "ftp://jenkins", wantErr: "the scheme must be one of: http, https"},
+		{raw: "http://", wantErr: "the host is missing"},
+		{raw: "http:///jenkins", wantErr: "the host is missing"},
+		{raw: "http://jen kins:8080", wantErr: "invalid Jenkins URL http://jen kins:8080"},
+		{raw: "http://jenkins:80 80", wantErr: "invalid Jenkins URL http://jenkins:80 80"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := NormalizeUrl(tt.raw)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NormalizeUrl(%q) = %q, %v, want error %q", tt.raw, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeUrl(%q) error = %s", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeUrl(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
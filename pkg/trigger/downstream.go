@@ -0,0 +1,97 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bndr/gojenkins"
+	"time"
+)
+
+// waitDownstream waits for the builds of the downstream projects of the job which are caused by the build of r,
+// and then for their downstream builds recursively, the jobs in visited are skipped to avoid waiting in cycles.
+// It fails on the first downstream build which is not completed successfully
+func waitDownstream(ctx context.Context, jenkins *gojenkins.Jenkins, c Config, r *Result, visited map[string]bool) error {
+	job, err := c.Job.getJob(ctx, jenkins)
+	if err != nil {
+		return fmt.Errorf("failed to get job %s: %w", r.Job, err)
+	}
+	visited[job.Raw.FullName] = true
+	for _, p := range job.Raw.DownstreamProjects {
+		j, err := jobOfUrl(p.Url)
+		if err != nil {
+			return fmt.Errorf("downstream project %s of job %s: %w", p.Name, r.Job, err)
+		}
+		if visited[j.FullName()] {
+			continue
+		}
+		dc := c
+		dc.Job = j
+		dc.Artifacts = Artifacts{}
+		dc.ConsoleLog = nil
+		dc.Wait.FollowFrom = 0
+		d := Result{Job: j.FullName()}
+		pollBuild := pollBuildResult(ctx, dc, jenkins, &d)
+		c.Logger.Info(fmt.Sprintf("Waiting for the downstream build of job %s caused by job %s, build number %d", d.Job, r.Job, r.BuildNumber))
+		var attempt uint
+		err = poll(ctx, jenkins, dc, &d, func() error {
+			defer func() { attempt++ }()
+			if d.BuildNumber == 0 {
+				number, err := findDownstreamBuild(ctx, jenkins, j, job.Raw.FullName, r.BuildNumber)
+				if err != nil {
+					return err
+				}
+				if number == 0 {
+					c.Logger.Info(fmt.Sprintf("Job %s, the downstream build is not found yet, retry after %s", d.Job, c.Wait.delay(attempt)))
+					return &IsStillQueued{time.Now(), d.Job, "waiting for the downstream build to be scheduled"}
+				}
+				d.BuildNumber = number
+			}
+			return pollBuild()
+		})
+		if err == nil {
+			err = waitDownstream(ctx, jenkins, dc, &d, visited)
+		}
+		e := Event{}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		c.emit(EventCompleted, &d, e)
+		r.Downstream = append(r.Downstream, d)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findDownstreamBuild scans the recent builds of the job j for the one caused by the build of number of the upstream job,
+// and returns 0 if it's not found
+func findDownstreamBuild(ctx context.Context, jenkins *gojenkins.Jenkins, j Job, upstream string, number int64) (int64, error) {
+	job, err := j.getJob(ctx, jenkins)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get job %s: %w", j.FullName(), err)
+	}
+	for i, b := range job.Raw.Builds {
+		if i >= correlationScanDepth {
+			break
+		}
+		build, err := j.getBuild(ctx, jenkins, b.Number)
+		if errors.Is(err, errBuildNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		for _, a := range build.Raw.Actions {
+			for _, cause := range a.Causes {
+				project, _ := cause["upstreamProject"].(string)
+				build, _ := cause["upstreamBuild"].(float64)
+				if project == upstream && int64(build) == number {
+					return b.Number, nil
+				}
+			}
+		}
+	}
+	return 0, nil
+}
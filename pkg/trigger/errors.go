@@ -0,0 +1,158 @@
+package trigger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The errors returned by Trigger, Start and WaitFor wrap the following sentinels, so that the outcomes can be told
+// apart with errors.Is, e.g., errors.Is(err, ErrBuildFailed), or inspected with errors.As, e.g., *BuildFailed
+var (
+	// ErrBuildFailed is matched by BuildFailed, the build is completed but not successfully
+	ErrBuildFailed = errors.New("build failed")
+	// ErrTimeout is matched by WaitTimeout, the waiting gave up before the build is completed
+	ErrTimeout = errors.New("wait timeout")
+	// ErrAuth is matched if Jenkins responds 401 or 403, e.g., the PAT is expired or the user lacks the permissions
+	ErrAuth = errors.New("unauthorized")
+	// ErrNotFound is matched if the job or the queue item is not found
+	ErrNotFound = errors.New("not found")
+	// ErrDisabled is matched if the job is disabled, which Jenkins refuses to trigger
+	ErrDisabled = errors.New("disabled")
+)
+
+// IsStillRunning indicate a Jenkins job is not done yet
+type IsStillRunning struct {
+	time        time.Time
+	jobName     string
+	buildNumber int64
+}
+
+func (r *IsStillRunning) Error() string {
+	return fmt.Sprintf("job %s, build number %d is still running. (%s)\n", r.jobName, r.buildNumber, r.time.Format(time.Stamp))
+}
+
+// IsStillQueued indicate a Jenkins build is waiting in the queue and has not started yet
+type IsStillQueued struct {
+	time    time.Time
+	jobName string
+	why     string
+}
+
+func (q *IsStillQueued) Error() string {
+	return fmt.Sprintf("job %s is still in the queue: %s (%s)", q.jobName, q.why, q.time.Format(time.Stamp))
+}
+
+// BuildFailed indicate a Jenkins build is completed but not successfully
+type BuildFailed struct {
+	jobName     string
+	buildNumber int64
+	result      string
+}
+
+// Is reports whether target is ErrBuildFailed
+func (f *BuildFailed) Is(target error) bool {
+	return target == ErrBuildFailed
+}
+
+func (f *BuildFailed) Error() string {
+	return fmt.Sprintf("Job %s Build number %d did not complete successfully: %s", f.jobName, f.buildNumber, f.result)
+}
+
+// WaitTimeout indicate the waiting for a Jenkins build gave up before the build is completed
+type WaitTimeout struct {
+	jobName     string
+	buildNumber int64
+	reason      string
+}
+
+// Is reports whether target is ErrTimeout
+func (t *WaitTimeout) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+func (t *WaitTimeout) Error() string {
+	if t.buildNumber == 0 {
+		return fmt.Sprintf("Job %s is not started, gave up waiting: %s", t.jobName, t.reason)
+	}
+	return fmt.Sprintf("Job %s Build number %d is not completed, gave up waiting: %s", t.jobName, t.buildNumber, t.reason)
+}
+
+// TestsFailed indicate a Jenkins build has failed tests, it matches ErrBuildFailed as well
+type TestsFailed struct {
+	jobName     string
+	buildNumber int64
+	failed      int64
+}
+
+// Is reports whether target is ErrBuildFailed
+func (f *TestsFailed) Is(target error) bool {
+	return target == ErrBuildFailed
+}
+
+func (f *TestsFailed) Error() string {
+	return fmt.Sprintf("Job %s Build number %d has %d failed tests", f.jobName, f.buildNumber, f.failed)
+}
+
+// httpError indicate Jenkins responds with an unexpected HTTP status
+type httpError struct {
+	status int
+	// retryAfter is how long to wait before the next request if Jenkins responds 429 or 503 with Retry-After
+	retryAfter time.Duration
+}
+
+// newHttpError returns the httpError of the response, along with its Retry-After
+func newHttpError(resp *http.Response) *httpError {
+	e := &httpError{status: resp.StatusCode}
+	if e.status == http.StatusTooManyRequests || e.status == http.StatusServiceUnavailable {
+		e.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+	return e
+}
+
+// parseRetryAfter parses the Retry-After header in either seconds or HTTP date, 0 if it's absent or invalid
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && time.Until(t) > 0 {
+		return time.Until(t).Round(time.Second)
+	}
+	return 0
+}
+
+func (e *httpError) Error() string {
+	msg := fmt.Sprintf("Jenkins responds %d %s", e.status, http.StatusText(e.status))
+	switch e.status {
+	case http.StatusUnauthorized:
+		msg += ", check the credentials of the user, e.g., the PAT may be expired or revoked"
+	case http.StatusForbidden:
+		msg += ", check the permissions of the user"
+	case http.StatusNotFound:
+		msg += ", check the name of the job, or whether it's deleted"
+	case http.StatusTooManyRequests:
+		msg += ", the requests are rate limited"
+	}
+	return msg
+}
+
+// Is reports whether target is ErrAuth for 401 and 403, or ErrNotFound for 404
+func (e *httpError) Is(target error) bool {
+	switch target {
+	case ErrAuth:
+		return e.status == http.StatusUnauthorized || e.status == http.StatusForbidden
+	case ErrNotFound:
+		return e.status == http.StatusNotFound
+	}
+	return false
+}
+
+// fatal reports whether retrying is pointless after the response, e.g., the credentials are expired
+func (e *httpError) fatal() bool {
+	return e.status == http.StatusUnauthorized || e.status == http.StatusForbidden || e.status == http.StatusNotFound
+}
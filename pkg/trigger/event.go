@@ -0,0 +1,35 @@
+package trigger
+
+import "time"
+
+const (
+	EventTriggered = "triggered"
+	EventQueued    = "queued"
+	EventRunning   = "running"
+	EventCompleted = "completed"
+)
+
+// Event is emitted on each step of triggering and waiting for the build, for the streaming consumers
+type Event struct {
+	// Status is one of EventTriggered, EventQueued, EventRunning and EventCompleted
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	// Elapsed is how long the build has been waiting in the queue or running
+	Elapsed string `json:"elapsed,omitempty"`
+	// Why is the reason of the build waiting in the queue
+	Why string `json:"why,omitempty"`
+	Result
+	// Error is why the waiting is failed, only set in the EventCompleted event
+	Error string `json:"error,omitempty"`
+}
+
+// emit passes the event of status with a snapshot of r to c.OnEvent if it's set
+func (c *Config) emit(status string, r *Result, e Event) {
+	if c.OnEvent == nil {
+		return
+	}
+	e.Status = status
+	e.Timestamp = time.Now()
+	e.Result = *r
+	c.OnEvent(e)
+}
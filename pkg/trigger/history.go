@@ -0,0 +1,63 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"github.com/bndr/gojenkins"
+	"net/http"
+	"time"
+)
+
+// resultBuilding is shown as the result of the builds in progress, which have no result yet
+const resultBuilding = "BUILDING"
+
+// Build is a recent build of the job
+type Build struct {
+	Number int64  `json:"number"`
+	Url    string `json:"url"`
+	// Result is the result of the build, or BUILDING if it's in progress
+	Result string `json:"result"`
+	// Started is when the build started
+	Started time.Time `json:"started"`
+	// Duration is how long the build took, or has been running if it's in progress, e.g., 1m30s
+	Duration string `json:"duration"`
+}
+
+// History fetches the last n builds of the job, the newest first
+func History(ctx context.Context, jenkins *gojenkins.Jenkins, j Job, n int) ([]Build, error) {
+	resp := struct {
+		Builds []struct {
+			Number    int64  `json:"number"`
+			Url       string `json:"url"`
+			Result    string `json:"result"`
+			Building  bool   `json:"building"`
+			Timestamp int64  `json:"timestamp"`
+			Duration  int64  `json:"duration"`
+		} `json:"builds"`
+	}{}
+	tree := fmt.Sprintf("builds[number,url,result,building,timestamp,duration]{0,%d}", n)
+	response, err := jenkins.Requester.GetJSON(ctx, j.Path(), &resp, map[string]string{"tree": tree})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get builds of job %s: %w", j.FullName(), err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get builds of job %s: %w", j.FullName(), newHttpError(response))
+	}
+	var builds []Build
+	for i, b := range resp.Builds {
+		if i >= n {
+			// the range of tree is ignored by some versions of Jenkins
+			break
+		}
+		started := time.Unix(0, b.Timestamp*int64(time.Millisecond))
+		build := Build{Number: b.Number, Url: b.Url, Result: b.Result, Started: started}
+		duration := time.Duration(b.Duration) * time.Millisecond
+		if b.Building {
+			build.Result = resultBuilding
+			duration = time.Since(started)
+		}
+		build.Duration = duration.Round(time.Second).String()
+		builds = append(builds, build)
+	}
+	return builds, nil
+}
@@ -0,0 +1,44 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"github.com/bndr/gojenkins"
+	"net/http"
+	"strings"
+)
+
+// Item is a job or a folder in Jenkins, e.g., a multibranch pipeline is a folder of the branch jobs
+type Item struct {
+	Name string `json:"name"`
+	// Folder reports whether the item contains other items
+	Folder bool `json:"folder"`
+}
+
+// Items lists the items in the folder of folders, outermost first, or at the root of Jenkins if folders is empty
+func Items(ctx context.Context, jenkins *gojenkins.Jenkins, folders []string) ([]Item, error) {
+	path := "/"
+	if len(folders) > 0 {
+		path = (&Job{Name: folders[len(folders)-1], Folders: folders[:len(folders)-1]}).Path()
+	}
+	resp := struct {
+		Jobs []struct {
+			Name string `json:"name"`
+			// Jobs is present only if the item is a folder
+			Jobs *[]struct{} `json:"jobs"`
+		} `json:"jobs"`
+	}{}
+	response, err := jenkins.Requester.GetJSON(ctx, path, &resp, map[string]string{"tree": "jobs[name,jobs[name]{0,1}]"})
+	name := strings.Join(folders, "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get items of folder %s: %w", name, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get items of folder %s: %w", name, newHttpError(response))
+	}
+	items := make([]Item, len(resp.Jobs))
+	for i, j := range resp.Jobs {
+		items[i] = Item{Name: j.Name, Folder: j.Jobs != nil}
+	}
+	return items, nil
+}
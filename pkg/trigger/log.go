@@ -0,0 +1,168 @@
+package trigger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+)
+
+// the ANSI escape codes of the colors
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
+// Level is the severity of a log record
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level of name, one of: debug, info, warn, error
+func ParseLevel(name string) (Level, error) {
+	for l, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %q, must be one of: %s, %s, %s, %s", name, LevelDebug, LevelInfo, LevelWarn, LevelError)
+}
+
+// Logger writes the log records at or above its level to w, a nil Logger discards all the records.
+// In text format, only the message is written, prefixed by the level unless it's info, and followed by the
+// attributes in key=value format, the statuses are colored if color is set. In json format, each record is written
+// as a JSON object per line
+type Logger struct {
+	w      io.Writer
+	level  Level
+	format string
+	color  bool
+	mu     sync.Mutex
+}
+
+// NewLogger returns a Logger writing the records at or above level to w in format, one of: text, json,
+// color turns on the ANSI colors in text format
+func NewLogger(w io.Writer, level Level, format string, color bool) (*Logger, error) {
+	if format != LogFormatText && format != LogFormatJson {
+		return nil, fmt.Errorf("invalid log format %q, must be one of: %s, %s", format, LogFormatText, LogFormatJson)
+	}
+	return &Logger{w: w, level: level, format: format, color: color && format == LogFormatText}, nil
+}
+
+// paint returns s in color if the colors are turned on
+func (l *Logger) paint(color, s string) string {
+	if l == nil || !l.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// paintResult returns the result of the build in green if it's SUCCESS, yellow if UNSTABLE, or red otherwise
+func (l *Logger) paintResult(result string) string {
+	switch result {
+	case resultSuccess:
+		return l.paint(colorGreen, result)
+	case resultUnstable:
+		return l.paint(colorYellow, result)
+	default:
+		return l.paint(colorRed, result)
+	}
+}
+
+// Enabled reports whether the records of level are written
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.level
+}
+
+// Debug logs msg with the attributes given in key, value pairs at debug level
+func (l *Logger) Debug(msg string, attrs ...interface{}) {
+	l.log(LevelDebug, msg, attrs)
+}
+
+// Info logs msg with the attributes given in key, value pairs at info level
+func (l *Logger) Info(msg string, attrs ...interface{}) {
+	l.log(LevelInfo, msg, attrs)
+}
+
+// Warn logs msg with the attributes given in key, value pairs at warn level
+func (l *Logger) Warn(msg string, attrs ...interface{}) {
+	l.log(LevelWarn, msg, attrs)
+}
+
+// Error logs msg with the attributes given in key, value pairs at error level
+func (l *Logger) Error(msg string, attrs ...interface{}) {
+	l.log(LevelError, msg, attrs)
+}
+
+func (l *Logger) log(level Level, msg string, attrs []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	if len(attrs)%2 != 0 {
+		attrs = append(attrs, nil)
+	}
+	var b strings.Builder
+	if l.format == LogFormatJson {
+		record := map[string]interface{}{
+			"time":  time.Now().Format(time.RFC3339Nano),
+			"level": level.String(),
+			"msg":   msg,
+		}
+		for i := 0; i < len(attrs); i += 2 {
+			record[fmt.Sprint(attrs[i])] = attrs[i+1]
+		}
+		if err := json.NewEncoder(&b).Encode(record); err != nil {
+			fmt.Fprintf(&b, "{\"level\":\"error\",\"msg\":%q}\n", fmt.Sprintf("failed to encode log record %q: %s", msg, err))
+		}
+	} else {
+		switch level {
+		case LevelDebug:
+			b.WriteString("Debug: ")
+		case LevelWarn:
+			b.WriteString(l.paint(colorYellow, "Warning:") + " ")
+		case LevelError:
+			b.WriteString(l.paint(colorRed, "Error:") + " ")
+		}
+		b.WriteString(msg)
+		for i := 0; i < len(attrs); i += 2 {
+			fmt.Fprintf(&b, " %v=%s", attrs[i], quote(fmt.Sprint(attrs[i+1])))
+		}
+		b.WriteString("\n")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// quote quotes s if it's empty or contains spaces, quotes or equal signs
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bndr/gojenkins"
+	"net/http"
+)
+
+// TestReport is the configuration of fetching the test results of the build once it's completed
+type TestReport struct {
+	Enabled bool `yaml:"enabled"`
+	// ListFailed lists the names of the failed tests
+	ListFailed bool `yaml:"list-failed"`
+	// FailOnFailures fails with TestsFailed if any test failed, even if the result of the build is SUCCESS
+	FailOnFailures bool `yaml:"fail-on-failures"`
+}
+
+// Tests is the summary of the test results of the build
+type Tests struct {
+	Total   int64 `json:"total"`
+	Failed  int64 `json:"failed"`
+	Skipped int64 `json:"skipped"`
+	// FailedTests are the names of the failed tests in className.name format, only if TestReport.ListFailed is set
+	FailedTests []string `json:"failedTests,omitempty"`
+}
+
+// fetchTestReport fetches the test results of the build of r into r.Tests, which stays nil if the build has no test report
+func fetchTestReport(ctx context.Context, c Config, jenkins *gojenkins.Jenkins, r *Result) error {
+	report := gojenkins.TestResult{}
+	tree := "failCount,passCount,skipCount"
+	if c.TestReport.ListFailed {
+		tree += ",suites[cases[className,name,status]]"
+	}
+	resp, err := jenkins.Requester.GetJSON(ctx, fmt.Sprintf("%s/%d/testReport", c.Job.Path(), r.BuildNumber), &report, map[string]string{"tree": tree})
+	if err != nil {
+		return fmt.Errorf("failed to get test report of job %s, build number %d: %w", r.Job, r.BuildNumber, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		c.Logger.Warn(fmt.Sprintf("Job %s, build number %d has no test report", r.Job, r.BuildNumber))
+		return nil
+	default:
+		return fmt.Errorf("failed to get test report of job %s, build number %d: %w", r.Job, r.BuildNumber, newHttpError(resp))
+	}
+	tests := &Tests{Total: report.PassCount + report.FailCount + report.SkipCount, Failed: report.FailCount, Skipped: report.SkipCount}
+	for _, suite := range report.Suites {
+		for _, tc := range suite.Cases {
+			// a test which failed since the previous build is a REGRESSION
+			if c.TestReport.ListFailed && (tc.Status == "FAILED" || tc.Status == "REGRESSION") {
+				tests.FailedTests = append(tests.FailedTests, tc.ClassName+"."+tc.Name)
+			}
+		}
+	}
+	r.Tests = tests
+	c.Logger.Info(fmt.Sprintf("Job %s, build number %d, tests: %d total, %d failed, %d skipped", r.Job, r.BuildNumber, tests.Total, tests.Failed, tests.Skipped))
+	for _, name := range tests.FailedTests {
+		c.Logger.Info(fmt.Sprintf("  %s %s", c.Logger.paint(colorRed, "FAILED"), name))
+	}
+	if c.TestReport.FailOnFailures && tests.Failed > 0 {
+		return &TestsFailed{jobName: r.Job, buildNumber: r.BuildNumber, failed: tests.Failed}
+	}
+	return nil
+}
+
+// testReportWanted reports whether the test report is fetched after waiting ends with err,
+// i.e., the build is completed, successfully or not
+func testReportWanted(c Config, err error) bool {
+	var failed *BuildFailed
+	return c.TestReport.Enabled && !c.Wait.ForStart && (err == nil || errors.As(err, &failed))
+}
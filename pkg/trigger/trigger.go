@@ -0,0 +1,1280 @@
+// Package trigger triggers Jenkins jobs and waits for the results.
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/avast/retry-go"
+	"github.com/bndr/gojenkins"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BackoffFixed       = "fixed"
+	BackoffExponential = "exponential"
+	resultSuccess      = "SUCCESS"
+	resultUnstable     = "UNSTABLE"
+	resultAborted      = "ABORTED"
+)
+
+// FollowFromEnd is Wait.FollowFrom to follow the logs from the end of the console output so far
+const FollowFromEnd int64 = -1
+
+// LastBuild is the ParamsFromBuild of copying the parameters from the last build of the job
+const LastBuild int64 = -1
+
+const (
+	// DefaultPollTime is how often to poll for the result if Wait.PollTime is not set
+	DefaultPollTime = 10 * time.Second
+	// DefaultMaxAttempts is the max count of polling for the result if Wait.MaxAttempts is not set
+	DefaultMaxAttempts uint = 60
+)
+
+// Config is the configuration of triggering a job
+type Config struct {
+	Jenkins Jenkins `yaml:"jenkins"`
+	Job     Job     `yaml:"job"`
+	Wait    Wait    `yaml:"wait"`
+	// Artifacts are downloaded after waiting for the build, if the pattern is set
+	Artifacts Artifacts `yaml:"artifacts"`
+	// TestReport is fetched after waiting for the build, if it's enabled
+	TestReport TestReport `yaml:"test-report"`
+	// TriggerRetries is how many times to retry triggering the job on the transient errors
+	TriggerRetries uint `yaml:"trigger-retries"`
+	// Timeout is the overall deadline of Trigger, 0 means no deadline
+	Timeout time.Duration `yaml:"timeout"`
+	// Logger logs the progress of triggering and waiting for the build, nil discards the logs
+	Logger *Logger `yaml:"-"`
+	// Progress is where the console output of the build is written to when following the logs, nil discards the output
+	Progress io.Writer `yaml:"-"`
+	// FailLog is where the console output of the failed build is written to, nil means Progress
+	FailLog io.Writer `yaml:"-"`
+	// ConsoleLog is where the full console output of the build is written to as it streams, regardless of
+	// Wait.FollowLogs, nil means none. The console output of the downstream builds is not written to it
+	ConsoleLog io.Writer `yaml:"-"`
+	// OnEvent is called on each step of triggering and waiting for the build if it's set
+	OnEvent func(Event) `yaml:"-"`
+}
+
+func (c *Config) progress() io.Writer {
+	if c.Progress == nil {
+		return io.Discard
+	}
+	return c.Progress
+}
+
+// console returns where the console output of the build is streamed to, nil if it's not streamed
+func (c *Config) console() io.Writer {
+	switch {
+	case c.Wait.FollowLogs && c.ConsoleLog != nil:
+		return io.MultiWriter(c.progress(), c.ConsoleLog)
+	case c.Wait.FollowLogs:
+		return c.progress()
+	default:
+		return c.ConsoleLog
+	}
+}
+
+func (c *Config) failLog() io.Writer {
+	if c.FailLog == nil {
+		return c.progress()
+	}
+	return c.FailLog
+}
+
+type Job struct {
+	Name string `yaml:"name"`
+	// Folders are the folders containing the job, from the outermost
+	Folders []string `yaml:"folders"`
+	// Branch is the branch of the job if it's a multibranch pipeline
+	Branch         string            `yaml:"branch"`
+	Params         map[string]string `yaml:"params"`
+	ValidateParams bool              `yaml:"validate-params"`
+	// CorrelationKey is the parameter in Params which identifies the build, the build is located by it instead of the queue item
+	CorrelationKey string `yaml:"correlation-key"`
+	// VerifyCorrelation trusts the build of the queue item if it carries the CorrelationKey parameter, the recent builds
+	// are scanned for it only if it does not
+	VerifyCorrelation bool `yaml:"verify-correlation"`
+	// Cause is set as the description of the build once it's started, only applies when waiting
+	Cause string `yaml:"cause"`
+	// Choices are the names of the parameters in Params which must be one of the choices defined by the job
+	Choices []string `yaml:"choices"`
+	// ParamsFromBuild is the number of the build to copy the parameters from, which are overridden by Params, 0 means none,
+	// LastBuild means the last build of the job
+	ParamsFromBuild int64 `yaml:"params-from-build"`
+	// Files are the file parameters, from the name of the parameter to the path of the file to upload
+	Files map[string]string `yaml:"files"`
+	// IfNotBuilding skips triggering the job if it has a build in progress or in the queue
+	IfNotBuilding bool `yaml:"if-not-building"`
+	// EnableIfDisabled enables the job before triggering it if it's disabled
+	EnableIfDisabled bool `yaml:"enable-if-disabled"`
+	// BuildToken is the token of "Trigger builds remotely" of the job, which authorizes triggering the job only
+	BuildToken string `yaml:"build-token"`
+	// ForceWithParameters always triggers the job at /buildWithParameters, even if it neither has nor is given any parameter
+	ForceWithParameters bool `yaml:"force-with-parameters"`
+}
+
+// segments returns the names of the items from the outermost folder to the job, or the branch if it's set
+func (j *Job) segments() []string {
+	segments := append(append([]string{}, j.Folders...), j.Name)
+	if j.Branch != "" {
+		// multibranch pipelines name the branch job with '%' and '/' encoded, e.g., feature/foo is named feature%2Ffoo
+		segments = append(segments, strings.NewReplacer("%", "%25", "/", "%2F").Replace(j.Branch))
+	}
+	return segments
+}
+
+// FullName returns the slash-delimited folders and name of the job, e.g., foo/bar/myjob, followed by the branch if it's set
+func (j *Job) FullName() string {
+	name := strings.Join(append(append([]string{}, j.Folders...), j.Name), "/")
+	if j.Branch != "" {
+		name += "/" + j.Branch
+	}
+	return name
+}
+
+// Path returns the path of the job relative to the Jenkins server, each segment is URL-encoded
+func (j *Job) Path() string {
+	var path strings.Builder
+	for _, segment := range j.segments() {
+		path.WriteString("/job/")
+		path.WriteString(url.PathEscape(segment))
+	}
+	return path.String()
+}
+
+// job returns the job on the Jenkins server without fetching it
+func (j *Job) job(jenkins *gojenkins.Jenkins) *gojenkins.Job {
+	return &gojenkins.Job{Jenkins: jenkins, Raw: new(gojenkins.JobResponse), Base: j.Path()}
+}
+
+// getJob fetches the job from the Jenkins server
+func (j *Job) getJob(ctx context.Context, jenkins *gojenkins.Jenkins) (*gojenkins.Job, error) {
+	job := j.job(jenkins)
+	// the same as job.Poll, which does not expose the headers of the response
+	resp, err := jenkins.Requester.GetJSON(ctx, job.Base, job.Raw, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHttpError(resp)
+	}
+	return job, nil
+}
+
+// buildingScanDepth is how many recent builds are checked for the ones in progress
+const buildingScanDepth = 10
+
+// building returns what the job is busy with, e.g., build number 42 is in progress, or empty if it's idle
+func (j *Job) building(ctx context.Context, jenkins *gojenkins.Jenkins) (string, error) {
+	job := struct {
+		InQueue bool `json:"inQueue"`
+		Builds  []struct {
+			Number   int64 `json:"number"`
+			Building bool  `json:"building"`
+		} `json:"builds"`
+	}{}
+	tree := fmt.Sprintf("inQueue,builds[number,building]{0,%d}", buildingScanDepth)
+	resp, err := jenkins.Requester.GetJSON(ctx, j.Path(), &job, map[string]string{"tree": tree})
+	if err != nil {
+		return "", fmt.Errorf("failed to get job %s: %w", j.FullName(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get job %s: %w", j.FullName(), newHttpError(resp))
+	}
+	for _, b := range job.Builds {
+		if b.Building {
+			return fmt.Sprintf("already building, build number %d is in progress", b.Number), nil
+		}
+	}
+	if job.InQueue {
+		return "already in the queue", nil
+	}
+	return "", nil
+}
+
+// errBuildNotFound is returned by getBuild if the build is not found, e.g., it's not materialized right after leaving the queue
+var errBuildNotFound = errors.New("build not found")
+
+// getBuild fetches the build of the job from the Jenkins server
+func (j *Job) getBuild(ctx context.Context, jenkins *gojenkins.Jenkins, number int64) (*gojenkins.Build, error) {
+	build := &gojenkins.Build{Jenkins: jenkins, Job: j.job(jenkins), Raw: new(gojenkins.BuildResponse), Depth: 1, Base: j.Path() + "/" + strconv.FormatInt(number, 10)}
+	// the same as build.Poll, which does not expose the headers of the response
+	resp, err := jenkins.Requester.GetJSON(ctx, build.Base, build.Raw, map[string]string{"depth": strconv.Itoa(build.Depth)})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errBuildNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHttpError(resp)
+	}
+	return build, nil
+}
+
+type Wait struct {
+	Enabled bool `yaml:"enabled"`
+	// PollTime is how often to poll for the result, 0 means DefaultPollTime
+	PollTime time.Duration `yaml:"poll-time"`
+	// MaxAttempts is the max count of polling for the result, 0 means DefaultMaxAttempts
+	MaxAttempts uint          `yaml:"max-attempts"`
+	FollowLogs  bool          `yaml:"follow-logs"`
+	Backoff     string        `yaml:"backoff"`
+	MaxPollTime time.Duration `yaml:"max-poll-time"`
+	// FailOnUnstable treats an UNSTABLE build as failed
+	FailOnUnstable bool `yaml:"fail-on-unstable"`
+	// AcceptResults are the results of the builds which count as succeeded, e.g., SUCCESS and ABORTED,
+	// which overrides the default of SUCCESS and UNSTABLE, and FailOnUnstable
+	AcceptResults []string `yaml:"accept-results"`
+	// QueueTimeout is how long the build can stay in the queue since it's triggered before the queue item is cancelled,
+	// 0 means no limit
+	QueueTimeout time.Duration `yaml:"queue-timeout"`
+	// AbortAfter is how long the build can keep running before it's aborted, 0 means no limit
+	AbortAfter time.Duration `yaml:"abort-after"`
+	// MaxLogBytes stops streaming the console output of the build once it exceeds this many bytes, both to
+	// Config.Progress with FollowLogs and to Config.ConsoleLog, while still waiting for the result, 0 means no limit
+	MaxLogBytes int64 `yaml:"max-log-bytes"`
+	// FollowFrom is the byte offset of the console output to start following the logs from, FollowFromEnd skips the
+	// console output so far, which is still downloaded once to find where it ends
+	FollowFrom int64 `yaml:"follow-from"`
+	// ForStart stops waiting once the build is started, instead of waiting for it to complete
+	ForStart bool `yaml:"for-start"`
+	// Downstream waits for the downstream builds caused by the build as well once it's completed, recursively
+	Downstream bool `yaml:"downstream"`
+	// FailLogLines is how many lines at the end of the console output are printed if the build did not succeed, 0 means none
+	FailLogLines uint `yaml:"fail-log-lines"`
+	// Jitter randomizes each delay between the polls by up to this fraction of it, e.g., 0.1 is ±10%,
+	// so that many waits with the same PollTime do not poll Jenkins in lockstep, 0 means none
+	Jitter float64 `yaml:"jitter"`
+}
+
+// accepted reports whether the build of result counts as succeeded
+func (w *Wait) accepted(result string) bool {
+	if len(w.AcceptResults) > 0 {
+		for _, accepted := range w.AcceptResults {
+			if strings.EqualFold(accepted, result) {
+				return true
+			}
+		}
+		return false
+	}
+	return result == resultSuccess || result == resultUnstable && !w.FailOnUnstable
+}
+
+// withDefaults returns w with the PollTime and MaxAttempts which are not set replaced by the defaults,
+// so that the zero value neither polls in a busy loop nor returns without polling
+func (w Wait) withDefaults() (Wait, error) {
+	if w.PollTime < 0 {
+		return w, fmt.Errorf("invalid poll time %s, must not be negative", w.PollTime)
+	}
+	if w.PollTime == 0 {
+		w.PollTime = DefaultPollTime
+	}
+	if w.MaxAttempts == 0 {
+		w.MaxAttempts = DefaultMaxAttempts
+	}
+	return w, nil
+}
+
+// delay returns how long to wait before the next poll after the n-th (starting from 0) attempt
+func (w *Wait) delay(n uint) time.Duration {
+	if w.Backoff != BackoffExponential {
+		return w.PollTime
+	}
+	d := w.PollTime
+	for i := uint(0); i < n && d < w.MaxPollTime; i++ {
+		d *= 2
+	}
+	if d > w.MaxPollTime {
+		return w.MaxPollTime
+	}
+	return d
+}
+
+var (
+	// jitterRand is seeded per process, unlike the global source of math/rand, so that the processes started
+	// at once do not jitter the same way
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterMu   sync.Mutex
+)
+
+// jitter randomizes d by up to w.Jitter of it in either direction
+func (w *Wait) jitter(d time.Duration) time.Duration {
+	if w.Jitter <= 0 {
+		return d
+	}
+	jitterMu.Lock()
+	f := jitterRand.Float64()*2 - 1
+	jitterMu.Unlock()
+	return d + time.Duration(f*w.Jitter*float64(d))
+}
+
+// Result is the outcome of triggering a job
+type Result struct {
+	Job         string `json:"job"`
+	QueueId     int64  `json:"queueId"`
+	QueueUrl    string `json:"queueUrl,omitempty"`
+	BuildNumber int64  `json:"buildNumber,omitempty"`
+	Url         string `json:"url,omitempty"`
+	Result      string `json:"result,omitempty"`
+	// Duration is how long the build took once it's completed, e.g., 1m30s
+	Duration string `json:"duration,omitempty"`
+	// BuiltOn is the name of the node which the build runs on, empty if it's unknown, e.g., still in the queue,
+	// or it runs on the built-in node
+	BuiltOn string `json:"builtOn,omitempty"`
+	// Artifacts are the paths of the downloaded artifacts
+	Artifacts []string `json:"artifacts,omitempty"`
+	// Downstream are the results of the downstream builds if waiting for them
+	Downstream []Result `json:"downstream,omitempty"`
+	// Tests is the summary of the test results if TestReport is enabled and the build has a test report
+	Tests *Tests `json:"tests,omitempty"`
+	// Skipped reports the job is not triggered, since it's already building with Job.IfNotBuilding
+	Skipped bool `json:"skipped,omitempty"`
+	// queued is when the job is triggered by Start, which Wait.QueueTimeout is measured from, zero if the queue item is
+	// not, e.g., of the wait command
+	queued time.Time
+}
+
+// Trigger triggers the job, and waits for the result if c.Wait is enabled.
+// The error matches ErrBuildFailed, ErrTimeout, ErrAuth, ErrNotFound or ErrDisabled with errors.Is depending on the outcome
+func Trigger(ctx context.Context, c Config) (Result, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	jenkins, err := c.Jenkins.CreateClient(ctx)
+	if err != nil {
+		return Result{Job: c.Job.FullName()}, err
+	}
+
+	r, err := Start(ctx, jenkins, c)
+	if err != nil {
+		return r, err
+	}
+
+	if !c.Wait.Enabled || r.Skipped {
+		return r, nil
+	}
+
+	err = WaitFor(ctx, jenkins, c, &r)
+	return r, err
+}
+
+// Start triggers the job without waiting for the result, the result is Skipped if the job is already building
+// with Job.IfNotBuilding
+func Start(ctx context.Context, jenkins *gojenkins.Jenkins, c Config) (Result, error) {
+	r := Result{Job: c.Job.FullName()}
+	if c.Job.IfNotBuilding {
+		building, err := c.Job.building(ctx, jenkins)
+		if err != nil {
+			return r, err
+		}
+		if building != "" {
+			c.Logger.Info(fmt.Sprintf("Job %s is %s, skip triggering", c.Job.FullName(), building))
+			r.Skipped = true
+			return r, nil
+		}
+	}
+	if c.Job.EnableIfDisabled {
+		if err := enableJob(ctx, jenkins, c); err != nil {
+			return r, err
+		}
+	}
+	if c.Job.ParamsFromBuild != 0 {
+		params, number, err := paramsFromBuild(ctx, jenkins, c.Job)
+		if err != nil {
+			return r, err
+		}
+		c.Job.Params = params
+		c.Logger.Info(fmt.Sprintf("Job %s, parameters copied from build number %d", c.Job.FullName(), number))
+	}
+	if c.Job.ValidateParams {
+		if err := validateParams(ctx, c, jenkins); err != nil {
+			return r, err
+		}
+	}
+	if len(c.Job.Choices) > 0 {
+		if err := validateChoices(ctx, c, jenkins); err != nil {
+			return r, err
+		}
+	}
+	var queueId int64
+	err := retry.Do(
+		func() (err error) {
+			queueId, err = buildJob(ctx, jenkins, c.Job)
+			return
+		},
+		retry.Attempts(c.TriggerRetries+1),
+		retry.Delay(time.Second),
+		retry.LastErrorOnly(true),
+		retry.Context(ctx),
+		retry.RetryIf(transient),
+		retry.OnRetry(func(n uint, err error) {
+			// it's called after the last attempt as well
+			if n < c.TriggerRetries {
+				c.Logger.Warn(fmt.Sprintf("failed to trigger job %s: %s, retrying (%d/%d)", c.Job.FullName(), err, n+1, c.TriggerRetries))
+			}
+		}),
+	)
+	if errors.Is(err, ErrDisabled) {
+		return r, err
+	}
+	if err != nil {
+		return r, fmt.Errorf("failed to trigger job %s: %w", c.Job.FullName(), err)
+	}
+	r.QueueId = queueId
+	r.QueueUrl = queueUrl(jenkins, queueId)
+	r.queued = time.Now()
+	c.Logger.Info(fmt.Sprintf("Job %s triggered successfully, queue item: %s", c.Job.FullName(), r.QueueUrl))
+	c.emit(EventTriggered, &r, Event{})
+	return r, nil
+}
+
+// transientStatus are the HTTP status which are worth retrying, e.g., from a flaky load balancer
+var transientStatus = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// transient reports whether err is worth retrying, i.e., the connection is refused before any request is sent,
+// or Jenkins responds with a transient status
+func transient(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	for _, code := range transientStatus {
+		// gojenkins reports the status only in the error message
+		if strings.Contains(err.Error(), fmt.Sprintf("%d %s", code, http.StatusText(code))) {
+			return true
+		}
+	}
+	return false
+}
+
+// colorDisabled is the color of the jobs which are disabled
+const colorDisabled = "disabled"
+
+// enableJob enables the job of c if it's disabled
+func enableJob(ctx context.Context, jenkins *gojenkins.Jenkins, c Config) error {
+	job, err := c.Job.getJob(ctx, jenkins)
+	if err != nil {
+		return err
+	}
+	if job.Raw.Color != colorDisabled {
+		return nil
+	}
+	c.Logger.Warn(fmt.Sprintf("Job %s is disabled, enabling it", c.Job.FullName()))
+	resp, err := jenkins.Requester.Post(ctx, c.Job.Path()+"/enable", nil, &struct{}{}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to enable job %s: %w", c.Job.FullName(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to enable job %s: %w", c.Job.FullName(), newHttpError(resp))
+	}
+	return nil
+}
+
+// buildJob triggers the job whether it is in folders or not, the path is URL-encoded
+func buildJob(ctx context.Context, jenkins *gojenkins.Jenkins, j Job) (int64, error) {
+	if len(j.Files) > 0 {
+		return buildJobWithFiles(ctx, jenkins, j)
+	}
+	return buildJobForm(ctx, jenkins, j)
+}
+
+// buildJobForm triggers the job with the parameters in a form, as gojenkins.Job.InvokeSimple does, and returns
+// the queue item in the Location header of the response. Unlike InvokeSimple, which skips the job already in the queue
+// and returns no queue item, it always submits the request, Jenkins then responds the queue item which is already
+// there if the parameters are the same, so the queue item is always known
+func buildJobForm(ctx context.Context, jenkins *gojenkins.Jenkins, j Job) (int64, error) {
+	job, err := j.getJob(ctx, jenkins)
+	if err != nil && (j.BuildToken == "" || !errors.Is(err, ErrAuth)) {
+		return 0, err
+	}
+	// with the build token, the job may not be readable, which is left to the build token to authorize
+	if job != nil && job.Raw.Color == colorDisabled {
+		return 0, fmt.Errorf("job %s is %w", j.FullName(), ErrDisabled)
+	}
+	endpoint := j.endpoint(job)
+	data := url.Values{}
+	for k, v := range j.Params {
+		data.Set(k, v)
+	}
+	ar := gojenkins.NewAPIRequest(http.MethodPost, j.Path()+endpoint, strings.NewReader(data.Encode()))
+	ar.SetHeader("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := jenkins.Requester.Do(ctx, ar, &struct{}{}, j.triggerQuery())
+	if err != nil {
+		return 0, err
+	}
+	return queueIdOf(j, resp)
+}
+
+// endpoint returns the endpoint to trigger the job at, which is /buildWithParameters if the job defines any parameter,
+// any parameter is given, or ForceWithParameters is set, otherwise /build, since Jenkins rejects the requests to
+// /buildWithParameters of the jobs which are not parameterized, and ignores the parameters sent to /build.
+// The definition of the job is nil if it's not readable
+func (j Job) endpoint(job *gojenkins.Job) string {
+	if j.ForceWithParameters || len(j.Params) > 0 {
+		return "/buildWithParameters"
+	}
+	if job == nil {
+		return "/build"
+	}
+	for _, p := range job.Raw.Property {
+		if len(p.ParameterDefinitions) > 0 {
+			return "/buildWithParameters"
+		}
+	}
+	return "/build"
+}
+
+// triggerQuery returns the query string of the requests to trigger the job, which carries the build token if it's set
+func (j Job) triggerQuery() map[string]string {
+	if j.BuildToken == "" {
+		return nil
+	}
+	return map[string]string{"token": j.BuildToken}
+}
+
+// queueIdOf returns the ID of the queue item in the Location header of the response of triggering the job
+func queueIdOf(j Job, resp *http.Response) (int64, error) {
+	if resp.StatusCode == http.StatusConflict {
+		// Jenkins responds 409 if the job is not buildable, e.g., it's disabled
+		return 0, fmt.Errorf("job %s is %w or not buildable: %s", j.FullName(), ErrDisabled, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return 0, fmt.Errorf("could not invoke job %q: %s", j.FullName(), resp.Status)
+	}
+	location := resp.Header.Get("Location")
+	u, err := url.Parse(location)
+	if err != nil || location == "" {
+		return 0, fmt.Errorf("invalid location %q of the queue item in the response", location)
+	}
+	queueId, err := strconv.ParseInt(path.Base(u.Path), 10, 64)
+	if err != nil || queueId <= 0 {
+		return 0, fmt.Errorf("invalid location %q of the queue item in the response", location)
+	}
+	return queueId, nil
+}
+
+// buildJobWithFiles triggers the job with the parameters and the files in a multipart form, which InvokeSimple does not support
+func buildJobWithFiles(ctx context.Context, jenkins *gojenkins.Jenkins, j Job) (int64, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for k, v := range j.Params {
+		if err := writer.WriteField(k, v); err != nil {
+			return 0, err
+		}
+	}
+	for name, file := range j.Files {
+		if err := writeFile(writer, name, file); err != nil {
+			return 0, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	ar := gojenkins.NewAPIRequest(http.MethodPost, j.Path()+"/buildWithParameters", body)
+	ar.SetHeader("Content-Type", writer.FormDataContentType())
+	resp, err := jenkins.Requester.Do(ctx, ar, &struct{}{}, j.triggerQuery())
+	if err != nil {
+		return 0, err
+	}
+	return queueIdOf(j, resp)
+}
+
+// writeFile writes the file at path as the file parameter of name to writer
+func writeFile(writer *multipart.Writer, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s of parameter %s: %w", file, name, err)
+	}
+	defer f.Close()
+	part, err := writer.CreateFormFile(name, filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return fmt.Errorf("failed to read file %s of parameter %s: %w", file, name, err)
+	}
+	return nil
+}
+
+// Parameter is the definition of a parameter of the job
+type Parameter struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	// Choices are the options of a choice parameter
+	Choices []string `json:"choices,omitempty"`
+}
+
+// Parameters fetches the parameter definitions of the job
+func Parameters(ctx context.Context, jenkins *gojenkins.Jenkins, j Job) ([]Parameter, error) {
+	resp := struct {
+		Property []struct {
+			ParameterDefinitions []struct {
+				Name                  string `json:"name"`
+				Type                  string `json:"type"`
+				Description           string `json:"description"`
+				DefaultParameterValue *struct {
+					Value interface{} `json:"value"`
+				} `json:"defaultParameterValue"`
+				Choices []string `json:"choices"`
+			} `json:"parameterDefinitions"`
+		} `json:"property"`
+	}{}
+	response, err := jenkins.Requester.GetJSON(ctx, j.Path(), &resp, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parameters of job %s: %w", j.FullName(), err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get parameters of job %s: %s", j.FullName(), response.Status)
+	}
+	var params []Parameter
+	for _, property := range resp.Property {
+		for _, d := range property.ParameterDefinitions {
+			p := Parameter{Name: d.Name, Type: d.Type, Description: d.Description, Choices: d.Choices}
+			if d.DefaultParameterValue != nil {
+				p.Default = d.DefaultParameterValue.Value
+			}
+			params = append(params, p)
+		}
+	}
+	return params, nil
+}
+
+// validateParams returns an error if any parameter is not defined by the job,
+// and warns about the defined parameters which are not supplied
+func validateParams(ctx context.Context, c Config, jenkins *gojenkins.Jenkins) error {
+	job, err := c.Job.getJob(ctx, jenkins)
+	if err != nil {
+		return fmt.Errorf("failed to get job %s: %w", c.Job.FullName(), err)
+	}
+	definitions, err := job.GetParameters(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get parameters of job %s: %w", c.Job.FullName(), err)
+	}
+	defined := make(map[string]bool)
+	for _, d := range definitions {
+		defined[d.Name] = true
+		_, file := c.Job.Files[d.Name]
+		if _, ok := c.Job.Params[d.Name]; !ok && !file {
+			c.Logger.Warn(fmt.Sprintf("parameter %s of job %s is not supplied, default value %v will be used", d.Name, c.Job.FullName(), d.DefaultParameterValue.Value))
+		}
+	}
+	var undefined []string
+	for name := range c.Job.Params {
+		if !defined[name] {
+			undefined = append(undefined, name)
+		}
+	}
+	for name := range c.Job.Files {
+		if !defined[name] {
+			undefined = append(undefined, name)
+		}
+	}
+	if len(undefined) > 0 {
+		sort.Strings(undefined)
+		return fmt.Errorf("job %s does not define parameters: %s", c.Job.FullName(), strings.Join(undefined, ", "))
+	}
+	return nil
+}
+
+// paramsFromBuild returns the parameters of the build j.ParamsFromBuild of the job, overridden by j.Params,
+// and the number of the build. The parameters without values, e.g., the passwords which are masked by Jenkins, are not copied
+func paramsFromBuild(ctx context.Context, jenkins *gojenkins.Jenkins, j Job) (map[string]string, int64, error) {
+	number := j.ParamsFromBuild
+	if number == LastBuild {
+		job, err := j.getJob(ctx, jenkins)
+		if err != nil {
+			return nil, 0, err
+		}
+		if number = job.Raw.LastBuild.Number; number == 0 {
+			return nil, 0, fmt.Errorf("job %s has no builds to copy the parameters from", j.FullName())
+		}
+	}
+	build := struct {
+		Actions []struct {
+			Parameters []struct {
+				Name  string      `json:"name"`
+				Value interface{} `json:"value"`
+			} `json:"parameters"`
+		} `json:"actions"`
+	}{}
+	endpoint := j.Path() + "/" + strconv.FormatInt(number, 10)
+	resp, err := jenkins.Requester.GetJSON(ctx, endpoint, &build, map[string]string{"tree": "actions[parameters[name,value]]"})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get job %s, build number %d: %w", j.FullName(), number, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("failed to get job %s, build number %d: %w", j.FullName(), number, newHttpError(resp))
+	}
+	params := make(map[string]string)
+	for _, a := range build.Actions {
+		for _, p := range a.Parameters {
+			if p.Value != nil {
+				params[p.Name] = fmt.Sprint(p.Value)
+			}
+		}
+	}
+	for k, v := range j.Params {
+		params[k] = v
+	}
+	return params, number, nil
+}
+
+// validateChoices returns an error if any parameter of c.Job.Choices is not a choice parameter of the job,
+// or its value is not one of the choices, which Jenkins only rejects after the job is triggered
+func validateChoices(ctx context.Context, c Config, jenkins *gojenkins.Jenkins) error {
+	params, err := Parameters(ctx, jenkins, c.Job)
+	if err != nil {
+		return err
+	}
+	choices := make(map[string][]string)
+	for _, p := range params {
+		if p.Choices != nil {
+			choices[p.Name] = p.Choices
+		}
+	}
+	for _, name := range c.Job.Choices {
+		defined, ok := choices[name]
+		if !ok {
+			return fmt.Errorf("parameter %s is not a choice parameter of job %s", name, c.Job.FullName())
+		}
+		value := c.Job.Params[name]
+		found := false
+		for _, choice := range defined {
+			found = found || choice == value
+		}
+		if !found {
+			return fmt.Errorf("value %q of parameter %s is not one of the choices of job %s: %s", value, name, c.Job.FullName(), strings.Join(defined, ", "))
+		}
+	}
+	return nil
+}
+
+// JobOfQueueItem resolves the job of the queue item of queueId from the URL of its task
+func JobOfQueueItem(ctx context.Context, jenkins *gojenkins.Jenkins, queueId int64) (Job, error) {
+	task, err := getQueueItem(ctx, jenkins, queueId)
+	if err != nil {
+		return Job{}, err
+	}
+	j, err := jobOfUrl(task.Task.URL)
+	if err != nil {
+		return Job{}, fmt.Errorf("queue item %d: %w", queueId, err)
+	}
+	return j, nil
+}
+
+// jobOfUrl resolves the job from the job/<name> segments of its URL
+func jobOfUrl(rawUrl string) (Job, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return Job{}, fmt.Errorf("invalid job url %s: %w", rawUrl, err)
+	}
+	var segments []string
+	split := strings.Split(u.EscapedPath(), "/")
+	for i := 0; i+1 < len(split); i++ {
+		if split[i] != "job" {
+			continue
+		}
+		segment, err := url.PathUnescape(split[i+1])
+		if err != nil {
+			return Job{}, fmt.Errorf("invalid job url %s: %w", rawUrl, err)
+		}
+		segments = append(segments, segment)
+		i++
+	}
+	if len(segments) == 0 {
+		return Job{}, fmt.Errorf("not a job: %s", rawUrl)
+	}
+	return Job{Name: segments[len(segments)-1], Folders: segments[:len(segments)-1]}, nil
+}
+
+// waitingItem is the class of the queue items in the quiet period
+const waitingItem = "hudson.model.Queue$WaitingItem"
+
+// queueItem is the queue item of Jenkins, along with the class and the timestamp which gojenkins does not expose
+type queueItem struct {
+	Class string `json:"_class"`
+	ID    int64  `json:"id"`
+	Why   string `json:"why"`
+	// Timestamp is when the quiet period ends if it's a waiting item, in milliseconds since the epoch
+	Timestamp int64 `json:"timestamp"`
+	Task      struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"task"`
+	Executable struct {
+		Number int64  `json:"number"`
+		URL    string `json:"url"`
+	} `json:"executable"`
+}
+
+// quietPeriod returns how long the queue item stays in the quiet period, 0 if it's not in the quiet period
+func (q *queueItem) quietPeriod() time.Duration {
+	if q.Class != waitingItem {
+		return 0
+	}
+	if d := time.Until(time.Unix(0, q.Timestamp*int64(time.Millisecond))); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// queueNotFoundPolls is how many polls the queue item triggered by Start can be not found before it's reported as gone,
+// so that the grace scales with Wait.PollTime and is bounded by Wait.MaxAttempts
+const queueNotFoundPolls = 3
+
+// getQueueItem fetches the queue item of queueId, the error matches ErrNotFound if it's not found,
+// e.g., Jenkins responds 404 for the queue items which are left for a while
+func getQueueItem(ctx context.Context, jenkins *gojenkins.Jenkins, queueId int64) (*queueItem, error) {
+	item := &queueItem{}
+	resp, err := jenkins.Requester.GetJSON(ctx, fmt.Sprintf("/queue/item/%d", queueId), item, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue item %d: %w", queueId, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return item, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("queue item %d is %w", queueId, ErrNotFound)
+	default:
+		return nil, fmt.Errorf("failed to get queue item %d: %w", queueId, newHttpError(resp))
+	}
+}
+
+// WaitFor polls the result of the build which is triggered by Start, until the build is completed.
+// If ctx is canceled, the build is aborted. Note that gojenkins does not attach ctx to the requests,
+// so the cancellation takes effect between the requests, and an in-flight one is bounded by Jenkins.RequestTimeout
+func WaitFor(ctx context.Context, jenkins *gojenkins.Jenkins, c Config, r *Result) error {
+	err := waitFor(ctx, jenkins, c, r)
+	e := Event{}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	c.emit(EventCompleted, r, e)
+	return err
+}
+
+// queueUrl returns the URL of the queue item of queueId
+func queueUrl(jenkins *gojenkins.Jenkins, queueId int64) string {
+	return fmt.Sprintf("%s/queue/item/%d/", jenkins.Server, queueId)
+}
+
+func waitFor(ctx context.Context, jenkins *gojenkins.Jenkins, c Config, r *Result) error {
+	var err error
+	if c.Wait, err = c.Wait.withDefaults(); err != nil {
+		return err
+	}
+	if r.QueueUrl == "" {
+		r.QueueUrl = queueUrl(jenkins, r.QueueId)
+	}
+	err = poll(ctx, jenkins, c, r, pollBuildResult(ctx, c, jenkins, r))
+	if testReportWanted(c, err) {
+		if e := fetchTestReport(ctx, c, jenkins, r); e != nil && err == nil {
+			return e
+		} else if e != nil {
+			c.Logger.Warn(e.Error())
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if c.Wait.Downstream && !c.Wait.ForStart {
+		if err := waitDownstream(ctx, jenkins, c, r, map[string]bool{}); err != nil {
+			return err
+		}
+	}
+	if c.Artifacts.Pattern != "" && !c.Wait.ForStart {
+		return downloadArtifacts(ctx, c, jenkins, r)
+	}
+	return nil
+}
+
+// poll retries pollBuild until the build of r is completed, or started if c.Wait.ForStart is set,
+// and turns the exhausted attempts and the deadline into WaitTimeout
+func poll(ctx context.Context, jenkins *gojenkins.Jenkins, c Config, r *Result, pollBuild func() error) error {
+	var last error
+	err := retry.Do(
+		func() error {
+			err := pollBuild()
+			var httpErr *httpError
+			if errors.Is(err, ErrNotFound) || errors.As(err, &httpErr) && httpErr.fatal() {
+				return retry.Unrecoverable(err)
+			}
+			return err
+		},
+		retry.DelayType(func(n uint, err error, _ *retry.Config) time.Duration {
+			d := c.Wait.delay(n)
+			var httpErr *httpError
+			if errors.As(err, &httpErr) && httpErr.retryAfter > d {
+				// Jenkins asks to slow down, e.g., rate limited
+				c.Logger.Warn(fmt.Sprintf("Job %s: %s, retry after %s", r.Job, httpErr, httpErr.retryAfter))
+				return httpErr.retryAfter
+			}
+			return c.Wait.jitter(d)
+		}),
+		retry.Attempts(c.Wait.MaxAttempts),
+		retry.LastErrorOnly(true),
+		retry.Context(ctx),
+		retry.OnRetry(func(n uint, err error) {
+			last = err
+		}),
+	)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t := &WaitTimeout{jobName: r.Job, reason: "deadline exceeded"}
+		if c.Timeout > 0 {
+			t.reason = fmt.Sprintf("timeout (%s) exceeded", c.Timeout)
+		}
+		var running *IsStillRunning
+		if errors.As(last, &running) {
+			t.buildNumber = running.buildNumber
+		}
+		return t
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		abortBuild(c, jenkins, r)
+		return fmt.Errorf("Job %s: %w", r.Job, err)
+	}
+	var running *IsStillRunning
+	if errors.As(err, &running) {
+		return &WaitTimeout{running.jobName, running.buildNumber, fmt.Sprintf("max attempts (%d) exhausted", c.Wait.MaxAttempts)}
+	}
+	var queued *IsStillQueued
+	if errors.As(err, &queued) {
+		return &WaitTimeout{jobName: queued.jobName, reason: fmt.Sprintf("max attempts (%d) exhausted", c.Wait.MaxAttempts)}
+	}
+	return err
+}
+
+// abortTimeout is the time limit of aborting the build
+const abortTimeout = 30 * time.Second
+
+// abortBuild is a best-effort to stop the build, or cancel the queue item if the build has not started yet.
+// It runs on its own context bounded by abortTimeout, since the context of waiting is usually done already
+func abortBuild(c Config, jenkins *gojenkins.Jenkins, r *Result) {
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+	if r.BuildNumber == 0 && r.QueueId == 0 {
+		// a downstream build which is not found yet
+		return
+	}
+	if r.BuildNumber == 0 {
+		task, err := jenkins.GetQueueItem(ctx, r.QueueId)
+		if err == nil {
+			_, err = task.Cancel(ctx)
+		}
+		if err != nil {
+			c.Logger.Error(fmt.Sprintf("failed to cancel queue item %d of job %s: %s", r.QueueId, r.Job, err))
+			return
+		}
+		c.Logger.Info(fmt.Sprintf("Job %s, queue item %d cancelled", r.Job, r.QueueId))
+		return
+	}
+	build, err := c.Job.getBuild(ctx, jenkins, r.BuildNumber)
+	if err == nil {
+		_, err = build.Stop(ctx)
+	}
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("failed to abort job %s, build number %d: %s", r.Job, r.BuildNumber, err))
+		return
+	}
+	c.Logger.Info(fmt.Sprintf("Job %s, build number %d aborted", r.Job, r.BuildNumber))
+}
+
+func pollBuildResult(ctx context.Context, c Config, jenkins *gojenkins.Jenkins, r *Result) func() error {
+	name := r.Job
+	offset := c.Wait.FollowFrom
+	console := c.console()
+	if console != nil && c.Wait.MaxLogBytes > 0 {
+		console = &limitWriter{w: console, n: c.Wait.MaxLogBytes}
+	}
+	// following is false once the console output exceeds Wait.MaxLogBytes
+	following := console != nil
+	var attempt uint
+	// the queue items which are not triggered by Start, e.g., of the wait command, are timed from the first poll
+	queued := r.queued
+	// seen is whether the queue item has been fetched, which may not be available yet right after triggering
+	seen := false
+	described := c.Job.Cause == ""
+	return func() error {
+		defer func() { attempt++ }()
+		if err := ctx.Err(); err != nil {
+			return retry.Unrecoverable(err)
+		}
+		if !c.Wait.FollowLogs {
+			c.Logger.Info(fmt.Sprintf("Polling build result for job %s", name))
+		}
+
+		if r.BuildNumber == 0 {
+			task, err := getQueueItem(ctx, jenkins, r.QueueId)
+			if err != nil && c.Job.CorrelationKey == "" {
+				if errors.Is(err, ErrNotFound) && !seen && !r.queued.IsZero() && attempt < queueNotFoundPolls {
+					c.Logger.Info(fmt.Sprintf("Job %s, queue item %d is not available yet, waiting for the build to be scheduled, retry after %s", name, r.QueueId, c.Wait.delay(attempt)))
+					return &IsStillQueued{time.Now(), name, "waiting for the build to be scheduled"}
+				}
+				if errors.Is(err, ErrNotFound) {
+					return retry.Unrecoverable(err)
+				}
+				return err
+			}
+			if err == nil {
+				seen = true
+			}
+			if err == nil && task.Executable.Number == 0 {
+				if queued.IsZero() {
+					queued = time.Now()
+				}
+				if c.Wait.QueueTimeout > 0 && time.Since(queued) >= c.Wait.QueueTimeout {
+					abortBuild(c, jenkins, r)
+					return retry.Unrecoverable(&WaitTimeout{jobName: name, reason: fmt.Sprintf("queue timeout (%s) exceeded: %s", c.Wait.QueueTimeout, task.Why)})
+				}
+				if quiet := task.quietPeriod(); quiet > 0 {
+					c.Logger.Info(fmt.Sprintf("Job %s is %s, starting in %s, retry after %s", name, c.Logger.paint(colorYellow, "in the quiet period"), quiet.Round(time.Second), c.Wait.delay(attempt)))
+				} else {
+					c.Logger.Info(fmt.Sprintf("Job %s is %s (%s), retry after %s", name, c.Logger.paint(colorYellow, "still in the queue"), task.Why, c.Wait.delay(attempt)))
+				}
+				c.emit(EventQueued, r, Event{Elapsed: time.Since(queued).Round(time.Second).String(), Why: task.Why})
+				return &IsStillQueued{time.Now(), name, task.Why}
+			}
+			// task is nil if the queue item is gone, e.g., expired, the build is still located by the correlation parameter
+			if c.Job.CorrelationKey == "" {
+				r.BuildNumber = task.Executable.Number
+			} else if r.BuildNumber, err = correlatedBuild(ctx, c, jenkins, r, task); err != nil {
+				return err
+			} else if r.BuildNumber == 0 {
+				c.Logger.Info(fmt.Sprintf("Job %s, build with parameter %s=%s is not found yet, retry after %s", name, c.Job.CorrelationKey, c.Job.Params[c.Job.CorrelationKey], c.Wait.delay(attempt)))
+				return &IsStillQueued{time.Now(), name, "waiting for the build to be scheduled"}
+			}
+		}
+
+		build, err := c.Job.getBuild(ctx, jenkins, r.BuildNumber)
+		if errors.Is(err, errBuildNotFound) {
+			c.Logger.Info(fmt.Sprintf("Job %s, build number %d is not available yet, waiting for the build to be scheduled, retry after %s", name, r.BuildNumber, c.Wait.delay(attempt)))
+			return &IsStillQueued{time.Now(), name, "waiting for the build to be scheduled"}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get job %s, build number %d: %w", name, r.BuildNumber, err)
+		}
+		if r.Url == "" && !c.Wait.ForStart {
+			c.Logger.Info(fmt.Sprintf("Job %s, build number %d: %s", name, r.BuildNumber, build.GetUrl()))
+		}
+		r.Url = build.GetUrl()
+		r.BuiltOn = build.Raw.BuiltOn
+
+		if !described {
+			if err := build.SetDescription(ctx, c.Job.Cause); err != nil {
+				c.Logger.Warn(fmt.Sprintf("failed to set the description of job %s, build number %d: %s", name, r.BuildNumber, err))
+			}
+			described = true
+		}
+
+		running := build.Raw.Building
+		if c.Wait.ForStart {
+			c.Logger.Info(fmt.Sprintf("Job %s, build number %d started%s: %s", name, r.BuildNumber, onNode(r.BuiltOn), r.Url))
+			return nil
+		}
+
+		if following {
+			if offset == FollowFromEnd {
+				if offset, err = followLogs(ctx, io.Discard, build, 0, false); err != nil {
+					return err
+				}
+			}
+			offset, err = followLogs(ctx, console, build, offset, !running)
+			if errors.Is(err, errLogLimit) {
+				c.Logger.Warn(fmt.Sprintf("Job %s, build number %d: the console output exceeds %d bytes, stopped following it, still waiting for the result", name, r.BuildNumber, c.Wait.MaxLogBytes))
+				following = false
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if running && c.Wait.AbortAfter > 0 && time.Since(build.GetTimestamp()) >= c.Wait.AbortAfter {
+			c.Logger.Warn(fmt.Sprintf("Job %s, build number %d has been running longer than %s, aborting", name, build.GetBuildNumber(), c.Wait.AbortAfter))
+			abortBuild(c, jenkins, r)
+			r.Result = resultAborted
+			r.Duration = time.Since(build.GetTimestamp()).Round(time.Second).String()
+			return retry.Unrecoverable(&BuildFailed{name, build.GetBuildNumber(), r.Result})
+		}
+
+		if running {
+			if !c.Wait.FollowLogs || !following {
+				c.Logger.Info(fmt.Sprintf("Job %s, build number %d is %s%s (%s), retry after %s", name, build.GetBuildNumber(), c.Logger.paint(colorYellow, "still running"), onNode(r.BuiltOn), elapsed(build), c.Wait.delay(attempt)))
+			}
+			c.emit(EventRunning, r, Event{Elapsed: time.Since(build.GetTimestamp()).Round(time.Second).String()})
+			return &IsStillRunning{time.Now(), name, build.GetBuildNumber()}
+		}
+
+		r.Result = build.GetResult()
+		r.Duration = (time.Duration(build.GetDuration()) * time.Millisecond).Round(time.Second).String()
+		c.Logger.Info(fmt.Sprintf("Job %s, build number %d completed%s with result %s", name, build.GetBuildNumber(), onNode(r.BuiltOn), c.Logger.paintResult(r.Result)))
+		if c.Wait.accepted(r.Result) {
+			return nil
+		}
+
+		if c.Wait.FailLogLines > 0 && !c.Wait.FollowLogs {
+			if err := logTail(ctx, c.failLog(), build, c.Wait.FailLogLines); err != nil {
+				c.Logger.Warn(fmt.Sprintf("failed to get the console output of job %s, build number %d: %s", name, build.GetBuildNumber(), err))
+			}
+		}
+		return retry.Unrecoverable(&BuildFailed{name, build.GetBuildNumber(), r.Result})
+	}
+}
+
+// onNode returns where the build runs on for the logs, e.g., " on agent-1", or empty if it's unknown
+func onNode(builtOn string) string {
+	if builtOn == "" {
+		return ""
+	}
+	return " on " + builtOn
+}
+
+// correlationScanDepth is how many recent builds are scanned to locate the build by the correlation parameter
+const correlationScanDepth = 20
+
+// correlatedBuild returns the number of the build carrying the correlation parameter, 0 if it's not found yet.
+// With Job.VerifyCorrelation, the build of task is verified first, and the recent builds are scanned only if it does not match
+func correlatedBuild(ctx context.Context, c Config, jenkins *gojenkins.Jenkins, r *Result, task *queueItem) (int64, error) {
+	j := c.Job
+	if j.VerifyCorrelation && task != nil {
+		number := task.Executable.Number
+		build, err := j.getBuild(ctx, jenkins, number)
+		if err != nil && !errors.Is(err, errBuildNotFound) {
+			return 0, fmt.Errorf("failed to get job %s, build number %d: %w", r.Job, number, err)
+		}
+		if err == nil {
+			if hasParam(build, j.CorrelationKey, j.Params[j.CorrelationKey]) {
+				return number, nil
+			}
+			c.Logger.Warn(fmt.Sprintf("Job %s, build number %d of queue item %d does not carry parameter %s=%s, scanning the recent builds for it", r.Job, number, r.QueueId, j.CorrelationKey, j.Params[j.CorrelationKey]))
+		}
+	}
+	return findBuild(ctx, jenkins, j)
+}
+
+// hasParam reports whether the build is triggered with the parameter name=value
+func hasParam(build *gojenkins.Build, name, value string) bool {
+	for _, p := range build.GetParameters() {
+		if p.Name == name && p.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// findBuild returns the number of the recent build whose correlation parameter matches, 0 if it's not found
+func findBuild(ctx context.Context, jenkins *gojenkins.Jenkins, j Job) (int64, error) {
+	job, err := j.getJob(ctx, jenkins)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get job %s: %w", j.FullName(), err)
+	}
+	value := j.Params[j.CorrelationKey]
+	for i, b := range job.Raw.Builds {
+		if i >= correlationScanDepth {
+			break
+		}
+		build, err := j.getBuild(ctx, jenkins, b.Number)
+		if errors.Is(err, errBuildNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if hasParam(build, j.CorrelationKey, value) {
+			return b.Number, nil
+		}
+	}
+	return 0, nil
+}
+
+// elapsed describes how long the build has been running, along with the estimated duration if it's available
+func elapsed(build *gojenkins.Build) string {
+	running := time.Since(build.GetTimestamp()).Round(time.Second)
+	estimated := time.Duration(build.Raw.EstimatedDuration) * time.Millisecond
+	if estimated <= 0 {
+		return running.String()
+	}
+	return fmt.Sprintf("%s / est. %s, %d%%", running, estimated.Round(time.Second), running*100/estimated)
+}
+
+// logTail writes the last n lines of the console output of the build to w
+func logTail(ctx context.Context, w io.Writer, build *gojenkins.Build, n uint) error {
+	var content string
+	response, err := build.Jenkins.Requester.GetXML(ctx, build.Base+"/consoleText", &content, nil)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return errors.New(response.Status)
+	}
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if uint(len(lines)) > n {
+		lines = lines[uint(len(lines))-n:]
+	}
+	fmt.Fprintf(w, "Last %d lines of the console output of build %s:\n", len(lines), build.GetUrl())
+	fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return nil
+}
+
+// errLogLimit is returned by limitWriter once the limit is exceeded
+var errLogLimit = errors.New("console output limit exceeded")
+
+// limitWriter writes up to n bytes to w, and fails with errLogLimit once more are written.
+// The cut-off output is terminated by a newline, so that it does not run into the following logs
+type limitWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= l.n {
+		l.n -= int64(len(p))
+		return l.w.Write(p)
+	}
+	p = p[:l.n]
+	l.n = 0
+	n, _ := l.w.Write(p)
+	if len(p) > 0 && p[len(p)-1] != '\n' {
+		l.w.Write([]byte("\n"))
+	}
+	return n, errLogLimit
+}
+
+// followLogs writes the console output of the build from offset to w, and returns the offset to continue from.
+// If drain is true, it keeps reading until Jenkins reports there is no more text
+func followLogs(ctx context.Context, w io.Writer, build *gojenkins.Build, offset int64, drain bool) (int64, error) {
+	for {
+		console, err := build.GetConsoleOutputFromIndex(ctx, offset)
+		if err != nil {
+			return offset, err
+		}
+		offset = console.Offset
+		// the other errors of writing, e.g., to a closed terminal, do not fail the waiting
+		if _, err := io.WriteString(w, console.Content); errors.Is(err, errLogLimit) {
+			return offset, err
+		}
+		if !drain || !console.HasMoreText {
+			return offset, nil
+		}
+	}
+}
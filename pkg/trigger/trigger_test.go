@@ -0,0 +1,461 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bndr/gojenkins"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newJenkins returns the client of the fake Jenkins server served by handler, which answers verifying the connection
+func newJenkins(t *testing.T, handler http.HandlerFunc) *gojenkins.Jenkins {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/json" {
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	j := &Jenkins{Url: server.URL, NoCrumb: true}
+	jenkins, err := j.CreateClient(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+	return jenkins
+}
+
+// requests records the request URIs which the fake Jenkins server receives
+type requests struct {
+	mu   sync.Mutex
+	uris []string
+}
+
+func (r *requests) add(req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.uris = append(r.uris, req.Method+" "+req.RequestURI)
+}
+
+func (r *requests) has(uri string) bool {
+	return r.count(uri) > 0
+}
+
+func (r *requests) count(uri string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, u := range r.uris {
+		if u == uri {
+			n++
+		}
+	}
+	return n
+}
+
+func TestJobPath(t *testing.T) {
+	tests := []struct {
+		name string
+		job  Job
+		want string
+	}{
+		{name: "plain", job: Job{Name: "myjob"}, want: "/job/myjob"},
+		{name: "space", job: Job{Name: "my job"}, want: "/job/my%20job"},
+		{name: "ampersand", job: Job{Name: "a&b"}, want: "/job/a&b"},
+		{name: "question mark", job: Job{Name: "a?b"}, want: "/job/a%3Fb"},
+		{name: "unicode", job: Job{Name: "作業"}, want: "/job/%E4%BD%9C%E6%A5%AD"},
+		{name: "folders", job: Job{Name: "myjob", Folders: []string{"foo", "bar"}}, want: "/job/foo/job/bar/job/myjob"},
+		{name: "folder with space", job: Job{Name: "myjob", Folders: []string{"my team"}}, want: "/job/my%20team/job/myjob"},
+		{name: "folder with ampersand", job: Job{Name: "myjob", Folders: []string{"r&d"}}, want: "/job/r&d/job/myjob"},
+		{name: "unicode folder", job: Job{Name: "myjob", Folders: []string{"團隊"}}, want: "/job/%E5%9C%98%E9%9A%8A/job/myjob"},
+		{name: "branch", job: Job{Name: "myjob", Branch: "feature/foo"}, want: "/job/myjob/job/feature%252Ffoo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.job.Path(); got != tt.want {
+				t.Errorf("Path() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildJobEscapesPath(t *testing.T) {
+	tests := []struct {
+		name string
+		job  Job
+		want string
+	}{
+		{name: "space", job: Job{Name: "my job"}, want: "POST /job/my%20job/build"},
+		{name: "ampersand", job: Job{Name: "a&b"}, want: "POST /job/a&b/build"},
+		{name: "unicode", job: Job{Name: "作業"}, want: "POST /job/%E4%BD%9C%E6%A5%AD/build"},
+		{name: "folders", job: Job{Name: "my job", Folders: []string{"r&d", "團隊"}}, want: "POST /job/r&d/job/%E5%9C%98%E9%9A%8A/job/my%20job/build"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqs := &requests{}
+			jenkins := newJenkins(t, func(w http.ResponseWriter, r *http.Request) {
+				reqs.add(r)
+				if r.Method == http.MethodGet {
+					fmt.Fprint(w, `{"color":"blue"}`)
+					return
+				}
+				w.Header().Set("Location", "/queue/item/7/")
+				w.WriteHeader(http.StatusCreated)
+			})
+			queueId, err := buildJob(context.Background(), jenkins, tt.job)
+			if err != nil {
+				t.Fatalf("buildJob() error = %s", err)
+			}
+			if queueId != 7 {
+				t.Errorf("buildJob() = %d, want 7", queueId)
+			}
+			if !reqs.has(tt.want) {
+				t.Errorf("requests = %s, want %s", strings.Join(reqs.uris, ", "), tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueIdOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		location string
+		want     int64
+		wantErr  string
+	}{
+		{name: "valid", status: http.StatusCreated, location: "http://jenkins:8080/queue/item/123/", want: 123},
+		{name: "without trailing slash", status: http.StatusCreated, location: "http://jenkins:8080/queue/item/123", want: 123},
+		{name: "under subpath", status: http.StatusCreated, location: "https://jenkins/jenkins/queue/item/42/", want: 42},
+		{name: "zero", status: http.StatusCreated, location: "http://jenkins:8080/queue/item/0/", wantErr: `invalid location "http://jenkins:8080/queue/item/0/"`},
+		{name: "empty", status: http.StatusCreated, location: "", wantErr: `invalid location ""`},
+		{name: "not a number", status: http.StatusCreated, location: "http://jenkins:8080/queue/item/abc/", wantErr: `invalid location "http://jenkins:8080/queue/item/abc/"`},
+		{name: "forbidden", status: http.StatusForbidden, wantErr: `could not invoke job "myjob"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status), Header: http.Header{}}
+			if tt.location != "" {
+				resp.Header.Set("Location", tt.location)
+			}
+			got, err := queueIdOf(Job{Name: "myjob"}, resp)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("queueIdOf() error = %v, want %q", err, tt.wantErr)
+				}
+				if got != 0 {
+					t.Errorf("queueIdOf() = %d along with the error, want 0", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("queueIdOf() error = %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("queueIdOf() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartWithoutQueueItem(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		wantErr  string
+	}{
+		{name: "missing location", wantErr: `invalid location "" of the queue item`},
+		{name: "missing queue number", location: "/queue/item/", wantErr: `invalid location "/queue/item/" of the queue item`},
+		{name: "not a queue item", location: "/job/myjob/", wantErr: `invalid location "/job/myjob/" of the queue item`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jenkins := newJenkins(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					fmt.Fprint(w, `{"color":"blue"}`)
+					return
+				}
+				if tt.location != "" {
+					w.Header().Set("Location", tt.location)
+				}
+				w.WriteHeader(http.StatusCreated)
+			})
+			r, err := Start(context.Background(), jenkins, Config{Job: Job{Name: "myjob"}})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Start() error = %v, want %q", err, tt.wantErr)
+			}
+			if r.QueueId != 0 {
+				t.Errorf("Start() queue ID = %d along with the error, want 0", r.QueueId)
+			}
+		})
+	}
+}
+
+func TestStartTopLevelAndFolderJobs(t *testing.T) {
+	jobs := []Job{
+		{Name: "myjob"},
+		{Name: "myjob", Folders: []string{"team", "sub"}},
+	}
+	tests := []struct {
+		name     string
+		inQueue  bool
+		location string
+		want     int64
+		wantErr  string
+	}{
+		{name: "valid", location: "/queue/item/5/", want: 5},
+		// Jenkins responds the existing queue item if the job is already in the queue
+		{name: "already in the queue", inQueue: true, location: "/queue/item/5/", want: 5},
+		{name: "zero", location: "/queue/item/0/", wantErr: `invalid location "/queue/item/0/"`},
+		{name: "empty location", wantErr: "failed to trigger job"},
+	}
+	for _, j := range jobs {
+		for _, tt := range tests {
+			t.Run(j.FullName()+"/"+tt.name, func(t *testing.T) {
+				reqs := &requests{}
+				jenkins := newJenkins(t, func(w http.ResponseWriter, r *http.Request) {
+					reqs.add(r)
+					if r.Method == http.MethodGet {
+						fmt.Fprintf(w, `{"color":"blue","inQueue":%t,"property":[{"parameterDefinitions":[{"name":"foo"}]}]}`, tt.inQueue)
+						return
+					}
+					if tt.location != "" {
+						w.Header().Set("Location", tt.location)
+					}
+					w.WriteHeader(http.StatusCreated)
+				})
+				c := Config{Job: j, Wait: Wait{Enabled: true}}
+				c.Job.Params = map[string]string{"foo": "bar"}
+				r, err := Start(context.Background(), jenkins, c)
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("Start() error = %v, want %q", err, tt.wantErr)
+					}
+				} else if err != nil {
+					t.Fatalf("Start() error = %s", err)
+				}
+				if r.QueueId != tt.want {
+					t.Errorf("Start() queue ID = %d, want %d", r.QueueId, tt.want)
+				}
+				if want := "POST " + j.Path() + "/buildWithParameters"; !reqs.has(want) {
+					t.Errorf("requests = %s, want %s", strings.Join(reqs.uris, ", "), want)
+				}
+			})
+		}
+	}
+}
+
+func TestWaitForNotAvailableYet(t *testing.T) {
+	tests := []struct {
+		name string
+		// queueMisses and buildMisses are how many times the queue item and the build respond 404 first
+		queueMisses int
+		buildMisses int
+	}{
+		{name: "queue item not available yet", queueMisses: 1},
+		{name: "build not available yet", buildMisses: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			queueMisses, buildMisses := tt.queueMisses, tt.buildMisses
+			jenkins := newJenkins(t, func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case r.Method == http.MethodPost:
+					w.Header().Set("Location", "/queue/item/5/")
+					w.WriteHeader(http.StatusCreated)
+				case r.URL.Path == "/job/myjob/api/json":
+					fmt.Fprint(w, `{"color":"blue"}`)
+				case r.URL.Path == "/queue/item/5/api/json" && queueMisses > 0:
+					queueMisses--
+					http.NotFound(w, r)
+				case r.URL.Path == "/queue/item/5/api/json":
+					fmt.Fprint(w, `{"id":5,"executable":{"number":1}}`)
+				case r.URL.Path == "/job/myjob/1/api/json" && buildMisses > 0:
+					buildMisses--
+					http.NotFound(w, r)
+				case r.URL.Path == "/job/myjob/1/api/json":
+					fmt.Fprint(w, `{"number":1,"result":"SUCCESS","url":"http://jenkins/job/myjob/1/"}`)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+			c := Config{
+				Job:  Job{Name: "myjob"},
+				Wait: Wait{Enabled: true, PollTime: time.Millisecond, MaxAttempts: 10, Backoff: BackoffFixed},
+			}
+			r, err := Start(context.Background(), jenkins, c)
+			if err != nil {
+				t.Fatalf("Start() error = %s", err)
+			}
+			if err := WaitFor(context.Background(), jenkins, c, &r); err != nil {
+				t.Fatalf("WaitFor() error = %s", err)
+			}
+			if r.BuildNumber != 1 || r.Result != "SUCCESS" {
+				t.Errorf("WaitFor() build number = %d, result = %s, want 1, SUCCESS", r.BuildNumber, r.Result)
+			}
+		})
+	}
+}
+
+func TestWaitForQueueItemGone(t *testing.T) {
+	jenkins := newJenkins(t, http.NotFound)
+	c := Config{
+		Job:  Job{Name: "myjob"},
+		Wait: Wait{Enabled: true, PollTime: time.Millisecond, MaxAttempts: 10, Backoff: BackoffFixed},
+	}
+	// not triggered by Start, e.g., of the wait command, the queue item is gone rather than not available yet
+	r := Result{Job: "myjob", QueueId: 5}
+	if err := WaitFor(context.Background(), jenkins, c, &r); !errors.Is(err, ErrNotFound) {
+		t.Errorf("WaitFor() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestStartWithFiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.zip")
+	if err := os.WriteFile(file, []byte("zip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// uploaded is the content of file parameter app of the last request
+	var uploaded string
+	jenkins := newJenkins(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"color":"blue","property":[{"parameterDefinitions":[{"name":"foo"},{"name":"app"}]}]}`)
+			return
+		}
+		if r.URL.Path != "/job/myjob/buildWithParameters" {
+			http.NotFound(w, r)
+			return
+		}
+		uploaded = ""
+		if err := r.ParseMultipartForm(1 << 20); err == nil {
+			if f, _, err := r.FormFile("app"); err == nil {
+				data, _ := io.ReadAll(f)
+				uploaded = string(data)
+			}
+		} else if err := r.ParseForm(); err != nil {
+			// the parameters only are posted in a form
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("foo") != "bar" {
+			http.Error(w, "parameter foo is missing", http.StatusBadRequest)
+			return
+		}
+		// Jenkins responds the same queue item while the build with the same parameters is in the queue
+		w.Header().Set("Location", "/queue/item/5/")
+		w.WriteHeader(http.StatusCreated)
+	})
+	tests := []struct {
+		name     string
+		files    map[string]string
+		uploaded string
+	}{
+		{name: "without files"},
+		{name: "with files", files: map[string]string{"app": file}, uploaded: "zip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Job: Job{Name: "myjob", Params: map[string]string{"foo": "bar"}, Files: tt.files}}
+			r, err := Start(context.Background(), jenkins, c)
+			if err != nil {
+				t.Fatalf("Start() error = %s", err)
+			}
+			if r.QueueId != 5 {
+				t.Errorf("Start() queue ID = %d, want 5", r.QueueId)
+			}
+			if uploaded != tt.uploaded {
+				t.Errorf("uploaded file = %q, want %q", uploaded, tt.uploaded)
+			}
+		})
+	}
+}
+
+func TestWaitForZeroWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		wait    Wait
+		polls   int
+		wantErr string
+	}{
+		// the build completes on the first poll, so that the default poll time is not waited for
+		{name: "zero value", polls: 1},
+		{name: "negative poll time", wait: Wait{PollTime: -time.Second}, wantErr: "invalid poll time -1s, must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqs := &requests{}
+			jenkins := newJenkins(t, func(w http.ResponseWriter, r *http.Request) {
+				reqs.add(r)
+				switch r.URL.Path {
+				case "/queue/item/5/api/json":
+					fmt.Fprint(w, `{"id":5,"executable":{"number":1}}`)
+				case "/job/myjob/1/api/json":
+					fmt.Fprint(w, `{"number":1,"result":"SUCCESS","url":"http://jenkins/job/myjob/1/"}`)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+			r := Result{Job: "myjob", QueueId: 5}
+			err := WaitFor(context.Background(), jenkins, Config{Job: Job{Name: "myjob"}, Wait: tt.wait}, &r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("WaitFor() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("WaitFor() error = %s", err)
+			}
+			if got := reqs.count("GET /queue/item/5/api/json"); got != tt.polls {
+				t.Errorf("queue item polled %d times, want %d", got, tt.polls)
+			}
+		})
+	}
+}
+
+func TestJobOfUrl(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{raw: "http://jenkins:8080/job/myjob/", want: "myjob"},
+		{raw: "http://jenkins:8080/jenkins/job/foo/job/my%20job/", want: "foo/my job"},
+		{raw: "http://jenkins:8080/job/%E4%BD%9C%E6%A5%AD/", want: "作業"},
+		{raw: "", wantErr: "not a job"},
+		{raw: "http://jenkins:8080/", wantErr: "not a job"},
+		{raw: "jenkins:8080/job/myjob/", wantErr: "not a job"},
+		{raw: "://", wantErr: "invalid job url ://"},
+		{raw: "://jenkins/job/myjob/", wantErr: "invalid job url ://jenkins/job/myjob/"},
+		{raw: "http://jen kins/job/myjob/", wantErr: "invalid job url http://jen kins/job/myjob/"},
+		{raw: "http://jenkins/job/my%zzjob/", wantErr: "invalid job url http://jenkins/job/my%zzjob/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := jobOfUrl(tt.raw)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("jobOfUrl(%q) = %+v, %v, want error %q", tt.raw, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("jobOfUrl(%q) error = %s", tt.raw, err)
+			}
+			if name := got.FullName(); name != tt.want {
+				t.Errorf("jobOfUrl(%q) = %s, want %s", tt.raw, name, tt.want)
+			}
+		})
+	}
+}